@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+// Authentication is enabled by setting OIDC_ISSUER. API requests then need a
+// JWT issued by it, either as a bearer token or in the session cookie set by
+// the login flow of the web app. Tokens must be issued for OIDC_AUDIENCE or
+// OIDC_CLIENT_ID, one of which is required, and are checked against the
+// issuer's published key set, or against OIDC_JWKS_URL or the local
+// OIDC_JWKS_FILE where given; the login flow needs the issuer's discovery
+// document and OIDC_CLIENT_ID.
+
+// User is the authenticated caller.
+type User struct {
+	Subject string                 `json:"sub"`
+	Name    string                 `json:"name,omitempty"`
+	Email   string                 `json:"email,omitempty"`
+	Roles   []string               `json:"roles"`
+	Claims  map[string]interface{} `json:"-"`
+}
+
+type authenticator struct {
+	verifier  *oidc.IDTokenVerifier
+	audiences []string
+	// login is nil when the issuer offers no discovery document.
+	login      *oauth2.Config
+	endSession string
+	roleClaims []string
+}
+
+// auth is nil while authentication is disabled.
+var auth *authenticator
+
+const (
+	sessionCookie = "eds_session"
+	loginCookie   = "eds_login"
+	userKey       = "user"
+)
+
+var signingAlgorithms = []string{
+	oidc.RS256, oidc.RS384, oidc.RS512,
+	oidc.ES256, oidc.ES384, oidc.ES512,
+	oidc.PS256, oidc.PS384, oidc.PS512,
+	oidc.EdDSA,
+}
+
+func newAuthenticator(ctx context.Context) (*authenticator, error) {
+	issuer := viper.GetString("OIDC_ISSUER")
+	if issuer == "" {
+		log.Println("OIDC_ISSUER is not set, authentication is disabled")
+		return nil, nil
+	}
+
+	a := &authenticator{roleClaims: splitList(viper.GetString("OIDC_ROLE_CLAIMS"))}
+	clientID := viper.GetString("OIDC_CLIENT_ID")
+	for _, audience := range []string{viper.GetString("OIDC_AUDIENCE"), clientID} {
+		if audience != "" {
+			a.audiences = append(a.audiences, audience)
+		}
+	}
+	// Without an audience, tokens the issuer grants any of its clients would
+	// be accepted.
+	if len(a.audiences) == 0 {
+		return nil, errors.New("OIDC_AUDIENCE or OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+	}
+
+	var keySet oidc.KeySet
+	switch {
+	case viper.GetString("OIDC_JWKS_FILE") != "":
+		keys, err := loadKeySet(viper.GetString("OIDC_JWKS_FILE"))
+		if err != nil {
+			return nil, err
+		}
+		keySet = keys
+	case viper.GetString("OIDC_JWKS_URL") != "":
+		keySet = oidc.NewRemoteKeySet(ctx, viper.GetString("OIDC_JWKS_URL"))
+	}
+
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		if keySet == nil {
+			return nil, fmt.Errorf("OIDC discovery for %s failed: %w", issuer, err)
+		}
+		log.Println("OIDC discovery failed, login is disabled:", err)
+	}
+
+	if keySet == nil {
+		var discovery struct {
+			JWKSURL string `json:"jwks_uri"`
+		}
+		if err := provider.Claims(&discovery); err != nil {
+			return nil, err
+		}
+		keySet = oidc.NewRemoteKeySet(ctx, discovery.JWKSURL)
+	}
+
+	// The audience is checked by authenticate, which accepts access tokens
+	// for the API as well as ID tokens for the web app.
+	a.verifier = oidc.NewVerifier(issuer, keySet, &oidc.Config{
+		SkipClientIDCheck:    true,
+		SupportedSigningAlgs: signingAlgorithms,
+	})
+
+	if provider != nil && clientID != "" {
+		a.login = &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: viper.GetString("OIDC_CLIENT_SECRET"),
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  viper.GetString("OIDC_REDIRECT_URL"),
+			Scopes:       splitList(viper.GetString("OIDC_SCOPES")),
+		}
+		var discovery struct {
+			EndSession string `json:"end_session_endpoint"`
+		}
+		if err := provider.Claims(&discovery); err == nil {
+			a.endSession = discovery.EndSession
+		}
+	}
+
+	return a, nil
+}
+
+// loadKeySet reads the public keys of a JWKS document. Private keys are
+// accepted too, so that a locally generated key set can sign test tokens.
+func loadKeySet(path string) (*oidc.StaticKeySet, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal(content, &jwks); err != nil {
+		return nil, fmt.Errorf("invalid key set %s: %w", path, err)
+	}
+
+	keys := &oidc.StaticKeySet{}
+	for _, key := range jwks.Keys {
+		if !key.IsPublic() {
+			key = key.Public()
+		}
+		if key.Key == nil {
+			continue
+		}
+		keys.PublicKeys = append(keys.PublicKeys, crypto.PublicKey(key.Key))
+	}
+	if len(keys.PublicKeys) == 0 {
+		return nil, errors.New("key set " + path + " holds no public keys")
+	}
+	return keys, nil
+}
+
+// splitList splits a comma or space separated setting.
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// authenticate verifies a token and returns its user.
+func (a *authenticator) authenticate(ctx context.Context, token string) (*User, error) {
+	idToken, err := a.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasAudience(idToken.Audience, a.audiences) {
+		return nil, errors.New("token has an unexpected audience")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	user := &User{Subject: idToken.Subject, Claims: claims, Roles: []string{}}
+	user.Name, _ = claims["name"].(string)
+	if user.Name == "" {
+		user.Name, _ = claims["preferred_username"].(string)
+	}
+	user.Email, _ = claims["email"].(string)
+
+	for _, claim := range a.roleClaims {
+		switch roles := claims[claim].(type) {
+		case string:
+			user.Roles = append(user.Roles, roles)
+		case []interface{}:
+			for _, role := range roles {
+				if role, ok := role.(string); ok {
+					user.Roles = append(user.Roles, role)
+				}
+			}
+		}
+	}
+	return user, nil
+}
+
+func hasAudience(audiences []string, expected []string) bool {
+	for _, audience := range audiences {
+		for _, want := range expected {
+			if audience == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authMiddleware rejects unauthenticated API calls with 401 and sends browsers
+// requesting the web app to the login flow.
+func authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if auth == nil || c.Request.Method == http.MethodOptions || strings.HasPrefix(path, "/auth/") ||
+			strings.HasPrefix(path, "/static") || path == "/favicon.ico" {
+			c.Next()
+			return
+		}
+
+		token := ""
+		if header := c.GetHeader("Authorization"); header != "" {
+			scheme, value, _ := strings.Cut(header, " ")
+			if !strings.EqualFold(scheme, "Bearer") {
+				c.AbortWithStatusJSON(401, gin.H{"error": "Unsupported authorization scheme"})
+				return
+			}
+			token = strings.TrimSpace(value)
+		} else if cookie, err := c.Cookie(sessionCookie); err == nil {
+			token = cookie
+		}
+
+		if token != "" {
+			user, err := auth.authenticate(c.Request.Context(), token)
+			if err == nil {
+				c.Set(userKey, user)
+				c.Next()
+				return
+			}
+			log.Println("Rejected token:", err)
+		}
+
+		if !strings.HasPrefix(path, "/api") && auth.login != nil {
+			c.Redirect(http.StatusFound, "/auth/login?redirect="+url.QueryEscape(c.Request.URL.RequestURI()))
+			c.Abort()
+			return
+		}
+
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(401, gin.H{"error": "Authentication required"})
+	}
+}
+
+// currentUser returns the authenticated caller, or nil while authentication
+// is disabled.
+func currentUser(c *gin.Context) *User {
+	if user, ok := c.Get(userKey); ok {
+		return user.(*User)
+	}
+	return nil
+}
+
+func getMe(c *gin.Context) {
+	user := currentUser(c)
+	if user == nil {
+		c.JSON(200, gin.H{"authenticated": false})
+		return
+	}
+	c.JSON(200, gin.H{"authenticated": true, "user": user})
+}
+
+// loginState is kept in a short lived cookie between the redirect to the
+// issuer and the callback.
+type loginState struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect"`
+}
+
+func (a *authenticator) redirectURL(c *gin.Context) string {
+	if a.login.RedirectURL != "" {
+		return a.login.RedirectURL
+	}
+	return requestBaseURL(c) + "/auth/callback"
+}
+
+func secureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+func setCookie(c *gin.Context, name string, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secureRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// localPath reports whether a redirect target stays on this server. Browsers
+// read a backslash like a slash, so "/\evil.com" would leave it.
+func localPath(target string) bool {
+	if !strings.HasPrefix(target, "/") || strings.ContainsRune(target, '\\') {
+		return false
+	}
+	u, err := url.Parse(target)
+	return err == nil && u.Scheme == "" && u.Host == "" && !strings.HasPrefix(u.Path, "//")
+}
+
+func login(c *gin.Context) {
+	if auth == nil || auth.login == nil {
+		c.JSON(404, gin.H{"error": "Login is not configured"})
+		return
+	}
+
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	redirect := c.Query("redirect")
+	if !localPath(redirect) {
+		redirect = "/"
+	}
+
+	state := loginState{
+		State:    base64.RawURLEncoding.EncodeToString(nonce),
+		Verifier: oauth2.GenerateVerifier(),
+		Redirect: redirect,
+	}
+	encoded, _ := json.Marshal(state)
+	setCookie(c, loginCookie, base64.RawURLEncoding.EncodeToString(encoded), 600)
+
+	config := *auth.login
+	config.RedirectURL = auth.redirectURL(c)
+	c.Redirect(http.StatusFound, config.AuthCodeURL(state.State, oauth2.S256ChallengeOption(state.Verifier)))
+}
+
+func loginCallback(c *gin.Context) {
+	if auth == nil || auth.login == nil {
+		c.JSON(404, gin.H{"error": "Login is not configured"})
+		return
+	}
+
+	var state loginState
+	cookie, err := c.Cookie(loginCookie)
+	if err == nil {
+		var encoded []byte
+		if encoded, err = base64.RawURLEncoding.DecodeString(cookie); err == nil {
+			err = json.Unmarshal(encoded, &state)
+		}
+	}
+	if err != nil || state.State == "" || c.Query("state") != state.State {
+		c.JSON(400, gin.H{"error": "Invalid login state"})
+		return
+	}
+	setCookie(c, loginCookie, "", -1)
+
+	if message := c.Query("error"); message != "" {
+		c.JSON(401, gin.H{"error": message + ": " + c.Query("error_description")})
+		return
+	}
+
+	config := *auth.login
+	config.RedirectURL = auth.redirectURL(c)
+	token, err := config.Exchange(c.Request.Context(), c.Query("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		c.JSON(401, gin.H{"error": err.Error()})
+		return
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		c.JSON(401, gin.H{"error": "No id_token in token response"})
+		return
+	}
+	idToken, err := auth.verifier.Verify(c.Request.Context(), rawIDToken)
+	if err != nil {
+		c.JSON(401, gin.H{"error": err.Error()})
+		return
+	}
+
+	setCookie(c, sessionCookie, rawIDToken, int(time.Until(idToken.Expiry).Seconds()))
+	c.Redirect(http.StatusFound, state.Redirect)
+}
+
+func logout(c *gin.Context) {
+	setCookie(c, sessionCookie, "", -1)
+
+	if auth != nil && auth.endSession != "" {
+		query := url.Values{
+			"client_id":                {auth.login.ClientID},
+			"post_logout_redirect_uri": {requestBaseURL(c) + "/"},
+		}
+		c.Redirect(http.StatusFound, auth.endSession+"?"+query.Encode())
+		return
+	}
+	c.Redirect(http.StatusFound, "/")
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/spf13/viper"
+)
+
+const testAudience = "easy-data-entry"
+
+// testIssuer is an in-process OIDC issuer publishing a discovery document and
+// the key set its tokens are signed with.
+type testIssuer struct {
+	url string
+	key *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                 issuer.url,
+			"authorization_endpoint": issuer.url + "/authorize",
+			"token_endpoint":         issuer.url + "/token",
+			"jwks_uri":               issuer.url + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	issuer.url = server.URL
+	return issuer
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// token signs claims on top of valid defaults; a nil claim removes the
+// default.
+func (i *testIssuer) token(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	return signToken(t, i.key, withClaims(map[string]interface{}{
+		"iss": i.url,
+		"aud": testAudience,
+		"sub": "ada",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}, claims))
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func withClaims(claims map[string]interface{}, overrides map[string]interface{}) map[string]interface{} {
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+	return claims
+}
+
+// enableAuth turns authentication on against the issuer.
+func enableAuth(t *testing.T, issuer *testIssuer) {
+	t.Helper()
+
+	viper.Set("OIDC_ISSUER", issuer.url)
+	viper.Set("OIDC_AUDIENCE", testAudience)
+	viper.Set("OIDC_ROLE_CLAIMS", "roles groups")
+
+	var err error
+	if auth, err = newAuthenticator(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	openTestDB(t, "")
+	issuer := newTestIssuer(t)
+	enableAuth(t, issuer)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"wrong audience", issuer.token(t, map[string]interface{}{"aud": "another-app"}), "audience"},
+		{"expired", issuer.token(t, map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}), "expired"},
+		{"wrong issuer", issuer.token(t, map[string]interface{}{"iss": "https://issuer.invalid"}), "issuer"},
+		{"bad signature", signToken(t, otherKey, map[string]interface{}{
+			"iss": issuer.url, "aud": testAudience, "sub": "ada", "exp": time.Now().Add(time.Hour).Unix(),
+		}), "signature"},
+		{"not a token", "not-a-token", "malformed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := auth.authenticate(context.Background(), test.token)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		token := issuer.token(t, map[string]interface{}{
+			"aud":    []string{"another-app", testAudience},
+			"name":   "Ada Lovelace",
+			"roles":  []string{"editor", "viewer"},
+			"groups": "staff",
+		})
+		user, err := auth.authenticate(context.Background(), token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Subject != "ada" || user.Name != "Ada Lovelace" || strings.Join(user.Roles, ",") != "editor,viewer,staff" {
+			t.Errorf("unexpected user %+v", user)
+		}
+	})
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	openTestDB(t, "CREATE TABLE notes (id INTEGER PRIMARY KEY)")
+	issuer := newTestIssuer(t)
+	enableAuth(t, issuer)
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", 401},
+		{"invalid token", issuer.token(t, map[string]interface{}{"aud": "another-app"}), 401},
+		{"valid token", issuer.token(t, nil), 200},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := serve(t, http.MethodGet, "/api/tables", "", test.token); w.Code != test.status {
+				t.Errorf("got %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorRequiresAudience(t *testing.T) {
+	openTestDB(t, "")
+	issuer := newTestIssuer(t)
+	viper.Set("OIDC_ISSUER", issuer.url)
+
+	if _, err := newAuthenticator(context.Background()); err == nil || !strings.Contains(err.Error(), "OIDC_AUDIENCE") {
+		t.Errorf("got error %v without an audience", err)
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	tests := map[string]bool{
+		"/":                   true,
+		"/tables/people?a=b":  true,
+		"":                    false,
+		"evil.com":            false,
+		"https://evil.com":    false,
+		"//evil.com":          false,
+		`/\evil.com`:          false,
+		"/%2F%2Fevil.com":     false,
+		"javascript:alert(1)": false,
+	}
+
+	for target, want := range tests {
+		if got := localPath(target); got != want {
+			t.Errorf("localPath(%q) = %v, want %v", target, got, want)
+		}
+	}
+}
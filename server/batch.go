@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// BatchOperation is one write of a batch. Data has the body of the matching
+// data endpoint: the row for create and update, its key and the changed
+// columns for patch, its key for delete. Table
+// is required for /api/batch and optional for /api/tables/:table/batch.
+type BatchOperation struct {
+	Op    string          `json:"op"`
+	Table string          `json:"table"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// BatchResult reports one operation. Status is success, failed, rolledBack
+// for operations undone by a later failure, or skipped for operations after
+// it. Data of an operation failed by a conflict is the current row.
+type BatchResult struct {
+	Index  int                    `json:"index"`
+	Op     string                 `json:"op"`
+	Table  string                 `json:"table,omitempty"`
+	Status string                 `json:"status"`
+	Keys   map[string]interface{} `json:"keys,omitempty"`
+	Data   interface{}            `json:"data,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+func tableBatch(c *gin.Context) {
+	table := tableParam(c)
+	runBatch(c, &table)
+}
+
+func batch(c *gin.Context) {
+	runBatch(c, nil)
+}
+
+// runBatch executes the operations in order in a single transaction. The
+// first failing operation rolls back the whole batch.
+func runBatch(c *gin.Context, table *TableRef) {
+	var req struct {
+		Operations []BatchOperation `json:"operations"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Operations) == 0 {
+		c.JSON(400, gin.H{"error": "No operations given"})
+		return
+	}
+
+	user := currentUser(c)
+	results := make([]BatchResult, len(req.Operations))
+	failed := -1
+	var failure error
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i, op := range req.Operations {
+			results[i] = BatchResult{Index: i, Op: op.Op}
+
+			target, err := batchTable(op, table)
+			if err == nil {
+				results[i].Table = target.String()
+				if permission, ok := operationPermissions[op.Op]; ok {
+					err = checkPermission(user, target, permission)
+				}
+			}
+			if err == nil {
+				err = executeOperation(tx, user, target, op, &results[i])
+			}
+			if err != nil {
+				failed, failure = i, err
+				return err
+			}
+			results[i].Status = "success"
+		}
+		return nil
+	})
+
+	if failed < 0 && err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if failed >= 0 {
+		for i := range results {
+			switch {
+			case i < failed:
+				results[i] = BatchResult{Index: i, Op: results[i].Op, Table: results[i].Table, Status: "rolledBack"}
+			case i == failed:
+				results[i].Status = "failed"
+				results[i].Error = failure.Error()
+				var conflict conflictError
+				if errors.As(failure, &conflict) {
+					results[i].Data = conflict.current
+				}
+			default:
+				results[i] = BatchResult{Index: i, Op: req.Operations[i].Op, Status: "skipped"}
+			}
+		}
+
+		// The batch endpoint itself accepts POST, so a write to a read-only
+		// view is a bad request here rather than a disallowed method.
+		status := errorStatus(failure)
+		if status == 405 {
+			status = 400
+		}
+
+		c.JSON(status, gin.H{
+			"error":   fmt.Sprintf("Operation %d failed: %s", failed, failure),
+			"results": results,
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "success", "results": results})
+}
+
+func batchTable(op BatchOperation, table *TableRef) (TableRef, error) {
+	if table != nil {
+		if op.Table != "" && parseTableRef(op.Table) != *table {
+			return TableRef{}, statusError{400, "Operation table " + op.Table + " does not match " + table.String()}
+		}
+		return *table, nil
+	}
+
+	if op.Table == "" {
+		return TableRef{}, statusError{400, "Missing table"}
+	}
+
+	target := parseTableRef(op.Table)
+	if _, ok := lookupTable(target); !ok {
+		return TableRef{}, statusError{404, "Table " + target.String() + " not found"}
+	}
+	return target, nil
+}
+
+// operationPermissions maps batch operations to the permission they need.
+// Invalid operations are left to executeOperation to report.
+var operationPermissions = map[string]string{
+	"create": permissionCreate,
+	"update": permissionUpdate,
+	"patch":  permissionUpdate,
+	"delete": permissionDelete,
+}
+
+func executeOperation(tx *gorm.DB, user *User, table TableRef, op BatchOperation, result *BatchResult) error {
+	switch op.Op {
+	case "create":
+		row, keys, err := insertRow(tx, user, table, op.Data)
+		if err != nil {
+			return err
+		}
+		result.Keys = keys
+		result.Data = row
+	case "update":
+		row, err := updateRow(tx, user, table, op.Data)
+		if err != nil {
+			return err
+		}
+		result.Data = row
+	case "patch":
+		row, err := patchRow(tx, user, table, op.Data)
+		if err != nil {
+			return err
+		}
+		result.Data = row
+	case "delete":
+		return deleteRow(tx, user, table, op.Data)
+	default:
+		return statusError{400, "Invalid operation: " + op.Op + ". Valid operations are: create, update, patch, delete"}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	openTestDB(t, accountsSchema+`;
+		CREATE VIEW rich_accounts AS SELECT * FROM accounts WHERE balance > 50`)
+	version := readRow(t, "accounts", "")["_version"]
+
+	tests := []struct {
+		name       string
+		target     string
+		operations []map[string]interface{}
+		status     int
+		results    []string
+	}{
+		{
+			name:   "failing operation",
+			target: "/api/tables/accounts/batch",
+			operations: []map[string]interface{}{
+				{"op": "create", "data": map[string]interface{}{"owner": "alan", "balance": 1}},
+				{"op": "patch", "data": map[string]interface{}{"id": 1, "balance": 0}},
+				{"op": "patch", "data": map[string]interface{}{"id": 7, "balance": 0}},
+				{"op": "delete", "data": map[string]interface{}{"id": 1, "_version": version}},
+			},
+			status:  404,
+			results: []string{"rolledBack", "rolledBack", "failed", "skipped"},
+		},
+		{
+			name:   "conflict",
+			target: "/api/batch",
+			operations: []map[string]interface{}{
+				{"op": "patch", "table": "accounts", "data": map[string]interface{}{"id": 1, "balance": 0}},
+				{"op": "update", "table": "accounts", "data": map[string]interface{}{"id": 1, "owner": "ada", "balance": 5, "_version": "stale"}},
+			},
+			status:  409,
+			results: []string{"rolledBack", "failed"},
+		},
+		{
+			name:   "missing table",
+			target: "/api/batch",
+			operations: []map[string]interface{}{
+				{"op": "create", "data": map[string]interface{}{"owner": "alan", "balance": 1}},
+			},
+			status:  400,
+			results: []string{"failed"},
+		},
+		{
+			name:   "view",
+			target: "/api/batch",
+			operations: []map[string]interface{}{
+				{"op": "create", "table": "accounts", "data": map[string]interface{}{"owner": "alan", "balance": 1}},
+				{"op": "create", "table": "rich_accounts", "data": map[string]interface{}{"owner": "grace", "balance": 99}},
+			},
+			status:  400,
+			results: []string{"rolledBack", "failed"},
+		},
+		{
+			name:   "invalid operation",
+			target: "/api/tables/accounts/batch",
+			operations: []map[string]interface{}{
+				{"op": "upsert", "data": map[string]interface{}{"id": 1}},
+			},
+			status:  400,
+			results: []string{"failed"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := jsonBody(t, map[string]interface{}{"operations": test.operations})
+			w := serve(t, http.MethodPost, test.target, body, "")
+			if w.Code != test.status {
+				t.Fatalf("got %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+
+			var response struct {
+				Results []BatchResult `json:"results"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			var results []string
+			for _, result := range response.Results {
+				results = append(results, result.Status)
+				if (result.Status == "failed") != (result.Error != "") {
+					t.Errorf("operation %d is %s with error %q", result.Index, result.Status, result.Error)
+				}
+			}
+			if !reflect.DeepEqual(results, test.results) {
+				t.Errorf("got results %v, want %v", results, test.results)
+			}
+
+			if row := readRow(t, "accounts", ""); row["balance"] != 100.0 || row["_version"] != version {
+				t.Errorf("failed batch changed the row: %v", row)
+			}
+			var count int64
+			db.Table("accounts").Count(&count)
+			if count != 1 {
+				t.Errorf("failed batch left %d rows", count)
+			}
+		})
+	}
+
+	t.Run("conflict reports the current row", func(t *testing.T) {
+		body := jsonBody(t, map[string]interface{}{"operations": []map[string]interface{}{
+			{"op": "update", "data": map[string]interface{}{"id": 1, "owner": "ada", "balance": 5, "_version": "stale"}},
+		}})
+		w := serve(t, http.MethodPost, "/api/tables/accounts/batch", body, "")
+		var response struct {
+			Results []struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"results"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if len(response.Results) != 1 || response.Results[0].Data["_version"] != version {
+			t.Errorf("conflict does not report the current row: %s", w.Body)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		body := jsonBody(t, map[string]interface{}{"operations": []map[string]interface{}{
+			{"op": "create", "data": map[string]interface{}{"owner": "alan", "balance": 1}},
+			{"op": "delete", "data": map[string]interface{}{"id": 1, "_version": version}},
+		}})
+		w := serve(t, http.MethodPost, "/api/tables/accounts/batch", body, "")
+		if w.Code != 200 {
+			t.Fatalf("got %d: %s", w.Code, w.Body)
+		}
+		var response struct {
+			Results []BatchResult `json:"results"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if len(response.Results) != 2 || response.Results[0].Keys["id"] != 2.0 || response.Results[1].Status != "success" {
+			t.Errorf("unexpected results %s", w.Body)
+		}
+
+		var owners []string
+		db.Table("accounts").Pluck("owner", &owners)
+		if !reflect.DeepEqual(owners, []string{"alan"}) {
+			t.Errorf("got owners %v after the batch", owners)
+		}
+	})
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ColumnRule restricts columns of the tables of a policy rule, for example
+//
+//	columns:
+//	  - columns: [Salary]
+//	    access: hidden
+//	  - columns: [IBAN]
+//	    access: masked
+//	    visible: 4
+//
+// Hidden columns are left out of the schema, reads and exports, masked
+// columns are read with all but their last Visible characters replaced, and
+// neither may be written, just like readOnly columns. A column gets the
+// least restrictive access of the rules applying to the caller that list it,
+// so a rule granting a table without column rules leaves the restrictions of
+// other rules in place; a rule lifts them by listing the column with access
+// full. Primary key columns identify rows in cursors and OData keys, so they
+// are at most readOnly.
+type ColumnRule struct {
+	Columns []string `mapstructure:"columns"`
+	Access  string   `mapstructure:"access"`
+	// Visible is the number of trailing characters a masked value keeps.
+	Visible *int `mapstructure:"visible"`
+}
+
+type columnAccess int
+
+const (
+	accessHidden columnAccess = iota
+	accessMasked
+	accessReadOnly
+	accessFull
+)
+
+var columnAccessNames = map[string]columnAccess{
+	"hidden":   accessHidden,
+	"masked":   accessMasked,
+	"readonly": accessReadOnly,
+	"full":     accessFull,
+}
+
+// defaultVisible is how many trailing characters a masked value keeps.
+const defaultVisible = 4
+
+func (r ColumnRule) validate() error {
+	if len(r.Columns) == 0 {
+		return errors.New("column rule needs columns")
+	}
+	if _, ok := columnAccessNames[strings.ToLower(r.Access)]; !ok {
+		return fmt.Errorf("invalid column access %q. Valid values are: hidden, masked, readOnly, full", r.Access)
+	}
+	if r.Visible != nil && *r.Visible < 0 {
+		return errors.New("visible cannot be negative")
+	}
+	return nil
+}
+
+type columnRestriction struct {
+	access  columnAccess
+	visible int
+}
+
+// restriction returns the access the rule grants to a column, or false when
+// the rule does not list it.
+func (r PolicyRule) restriction(column string) (columnRestriction, bool) {
+	for _, rule := range r.Columns {
+		for _, name := range rule.Columns {
+			if strings.EqualFold(name, column) {
+				restriction := columnRestriction{access: columnAccessNames[strings.ToLower(rule.Access)], visible: defaultVisible}
+				if rule.Visible != nil {
+					restriction.visible = *rule.Visible
+				}
+				return restriction, true
+			}
+		}
+	}
+	return columnRestriction{}, false
+}
+
+// columnRestrictions maps the restricted columns of a table to what a caller
+// may do with them. Columns that are not in the map are unrestricted.
+type columnRestrictions map[string]columnRestriction
+
+func restrictColumns(user *User, table TableRef) (columnRestrictions, error) {
+	restrictions := make(columnRestrictions)
+	if policy == nil {
+		return restrictions, nil
+	}
+
+	rules := policy.rules(user, table)
+	if len(rules) == 0 {
+		return restrictions, nil
+	}
+
+	columns, err := getSchemaColumns(table)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, col := range columns {
+		best := columnRestriction{access: -1}
+		for _, rule := range rules {
+			r, ok := rule.restriction(col.DbName)
+			if ok && (r.access > best.access || (r.access == best.access && r.visible > best.visible)) {
+				best = r
+			}
+		}
+		if best.access < 0 {
+			best = columnRestriction{access: accessFull}
+		}
+		if col.Key && best.access < accessReadOnly {
+			best = columnRestriction{access: accessReadOnly}
+		}
+		if best.access < accessFull {
+			restrictions[col.DbName] = best
+		}
+	}
+	return restrictions, nil
+}
+
+func (r columnRestrictions) hidden(column string) bool {
+	restriction, ok := r[column]
+	return ok && restriction.access == accessHidden
+}
+
+func (r columnRestrictions) masked(column string) bool {
+	restriction, ok := r[column]
+	return ok && restriction.access == accessMasked
+}
+
+// searchable reports whether the caller may filter and sort by the column.
+func (r columnRestrictions) searchable(column string) bool {
+	return !r.hidden(column) && !r.masked(column)
+}
+
+// writable reports whether the caller may set the column.
+func (r columnRestrictions) writable(column string) bool {
+	_, ok := r[column]
+	return !ok
+}
+
+// visible drops the hidden columns.
+func (r columnRestrictions) visible(columns []SchemaColumn) []SchemaColumn {
+	if len(r) == 0 {
+		return columns
+	}
+	visible := make([]SchemaColumn, 0, len(columns))
+	for _, col := range columns {
+		if !r.hidden(col.DbName) {
+			visible = append(visible, col)
+		}
+	}
+	return visible
+}
+
+// checkSearchable rejects filtering or sorting by hidden and masked columns,
+// which would reveal their values. Hidden columns are reported as unknown.
+func (r columnRestrictions) checkSearchable(fields []string) error {
+	for _, field := range fields {
+		if r.hidden(field) {
+			return errors.New("Invalid column name: " + field)
+		}
+		if r.masked(field) {
+			return errors.New("Column " + field + " cannot be filtered or sorted")
+		}
+	}
+	return nil
+}
+
+// checkWrite rejects values for columns the caller may not set.
+func (r columnRestrictions) checkWrite(fields map[string]json.RawMessage) error {
+	for name := range fields {
+		if !r.writable(name) {
+			return statusError{403, "Permission denied: write on column " + name}
+		}
+	}
+	return nil
+}
+
+// checkUnchanged rejects restricted values that differ from what the caller
+// reads from the current row.
+func (r columnRestrictions) checkUnchanged(fields map[string]json.RawMessage, current interface{}) error {
+	values := convertGormStructToMap(current)
+	for name, value := range fields {
+		if r.hidden(name) || !sameJSON(value, r.value(name, values[name])) {
+			return statusError{403, "Permission denied: write on column " + name}
+		}
+	}
+	return nil
+}
+
+// sameJSON compares a JSON value with the encoding of a Go value.
+func sameJSON(raw json.RawMessage, value interface{}) bool {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	var a, b interface{}
+	if json.Unmarshal(raw, &a) != nil || json.Unmarshal(encoded, &b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// mask replaces all but the last visible characters of a value. Values too
+// short to keep any characters are masked completely.
+func mask(value interface{}, visible int) interface{} {
+	if value == nil {
+		return nil
+	}
+	text := []rune(exportText(value))
+	if len(text) <= visible {
+		return strings.Repeat("*", len(text))
+	}
+	return strings.Repeat("*", len(text)-visible) + string(text[len(text)-visible:])
+}
+
+// value returns a column value as the caller may read it.
+func (r columnRestrictions) value(column string, value interface{}) interface{} {
+	if restriction, ok := r[column]; ok && restriction.access == accessMasked {
+		return mask(value, restriction.visible)
+	}
+	return value
+}
+
+// row converts a row, given as a pointer to its struct, to what the caller
+// may read. The row is returned as is when nothing is restricted.
+func (r columnRestrictions) row(row interface{}) interface{} {
+	if len(r) == 0 {
+		return row
+	}
+
+	values := convertGormStructToMap(row)
+	for name, value := range values {
+		if r.hidden(name) {
+			delete(values, name)
+		} else {
+			values[name] = r.value(name, value)
+		}
+	}
+	if version := requestedVersion(row); version != "" {
+		values["_version"] = version
+	}
+	return values
+}
+
+// rows applies row to every row in a slice.
+func (r columnRestrictions) rows(rows reflect.Value) interface{} {
+	if len(r) == 0 {
+		return rows.Interface()
+	}
+
+	result := make([]interface{}, rows.Len())
+	for i := range result {
+		result[i] = r.row(rows.Index(i).Addr().Interface())
+	}
+	return result
+}
+
+// checkQuery rejects filters and sorting the caller may not use.
+func (r columnRestrictions) checkQuery(where FilterNode, sort []SortColumn) error {
+	if len(r) == 0 {
+		return nil
+	}
+
+	fields := filterFields(where, nil)
+	for _, s := range sort {
+		fields = append(fields, s.Field)
+	}
+	return r.checkSearchable(fields)
+}
+
+// filterFields appends the columns a filter refers to.
+func filterFields(node FilterNode, fields []string) []string {
+	if node.Field != "" {
+		fields = append(fields, node.Field)
+	}
+	for _, child := range node.Children {
+		fields = filterFields(child, fields)
+	}
+	for _, condition := range node.Conditions {
+		fields = filterFields(condition, fields)
+	}
+	return fields
+}
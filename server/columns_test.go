@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const staffSchema = `
+CREATE TABLE staff (id INTEGER PRIMARY KEY, name TEXT, salary INTEGER, iban TEXT, note TEXT);
+INSERT INTO staff VALUES (1, 'ada', 5000, 'DE89370400440532013000', 'first'), (2, 'alan', 6000, NULL, NULL);
+CREATE TABLE events (secret TEXT, message TEXT);
+INSERT INTO events VALUES ('s1', 'a'), ('s2', 'b')`
+
+func restrictStaff() {
+	visible := 4
+	policy = &Policy{Rules: []PolicyRule{{
+		Roles:       []string{"*"},
+		Tables:      []string{"*"},
+		Permissions: []string{"*"},
+		Columns: []ColumnRule{
+			{Columns: []string{"ID", "salary", "secret"}, Access: "hidden"},
+			{Columns: []string{"iban"}, Access: "masked", Visible: &visible},
+			{Columns: []string{"note"}, Access: "readOnly"},
+		},
+	}}}
+}
+
+func TestColumnRulesOnRead(t *testing.T) {
+	openTestDB(t, staffSchema)
+	restrictStaff()
+
+	row := readRow(t, "staff", "")
+	if _, ok := row["salary"]; ok {
+		t.Errorf("hidden column is read: %v", row)
+	}
+	if row["id"] != 1.0 {
+		t.Errorf("key column is hidden: %v", row)
+	}
+	if row["iban"] != "******************3000" || row["note"] != "first" {
+		t.Errorf("unexpected row %v", row)
+	}
+
+	w := serve(t, http.MethodGet, "/api/tables/staff/schema", "", "")
+	if strings.Contains(w.Body.String(), "salary") {
+		t.Errorf("schema lists the hidden column: %s", w.Body)
+	}
+
+	for _, target := range []string{
+		"/api/tables/staff/data?sort=salary",
+		"/api/tables/staff/data?sort=iban",
+		"/api/tables/staff/odata?$filter=salary+gt+5500",
+		"/api/tables/staff/odata?$filter=startswith(iban,+'DE')",
+	} {
+		if w := serve(t, http.MethodGet, target, "", ""); w.Code != 400 {
+			t.Errorf("%s: got %d, want 400", target, w.Code)
+		}
+	}
+}
+
+func TestColumnRulesOnWrite(t *testing.T) {
+	openTestDB(t, staffSchema)
+	restrictStaff()
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"patch hidden", http.MethodPatch, `{"id": 1, "salary": 1}`, 403},
+		{"patch masked", http.MethodPatch, `{"id": 1, "iban": "GB00"}`, 403},
+		{"patch read-only", http.MethodPatch, `{"id": 1, "note": "changed"}`, 403},
+		{"patch writable", http.MethodPatch, `{"id": 1, "name": "ada l"}`, 200},
+		{"create with read-only", http.MethodPost, `{"id": 3, "name": "grace", "note": "x"}`, 403},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := serve(t, test.method, "/api/tables/staff/data", test.body, ""); w.Code != test.status {
+				t.Errorf("got %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+		})
+	}
+
+	// Created rows are returned, with their keys, as the caller may read them.
+	for _, target := range []string{"/api/tables/staff/data", "/api/tables/staff/batch"} {
+		body := `{"name": "grace", "iban": null}`
+		if target != "/api/tables/staff/data" {
+			body = `{"operations": [{"op": "create", "data": ` + body + `}]}`
+		}
+		w := serve(t, http.MethodPost, target, body, "")
+		if w.Code != 200 {
+			t.Fatalf("%s: create returned %d: %s", target, w.Code, w.Body)
+		}
+		var response struct {
+			Keys    map[string]interface{}
+			Data    map[string]interface{}
+			Results []BatchResult
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if len(response.Results) == 1 {
+			response.Keys = response.Results[0].Keys
+			response.Data, _ = response.Results[0].Data.(map[string]interface{})
+		}
+		if response.Keys["id"] == nil || response.Keys["id"] != response.Data["id"] || response.Data["name"] != "grace" {
+			t.Errorf("%s: unexpected response %s", target, w.Body)
+		}
+		if _, ok := response.Data["salary"]; ok {
+			t.Errorf("%s: created row reveals the hidden column: %s", target, w.Body)
+		}
+	}
+
+	// A full row read back by the caller may be written back unchanged.
+	row := readRow(t, "staff", "")
+	row["name"] = "ada"
+	if w := serve(t, http.MethodPut, "/api/tables/staff/data", jsonBody(t, row), ""); w.Code != 200 {
+		t.Errorf("writing back a masked row returned %d: %s", w.Code, w.Body)
+	}
+
+	var salary int64
+	var iban, note string
+	db.Table("staff").Where("id = 1").Select("salary, iban, note").Row().Scan(&salary, &iban, &note)
+	if salary != 5000 || iban != "DE89370400440532013000" || note != "first" {
+		t.Errorf("restricted columns changed to %d, %s, %s", salary, iban, note)
+	}
+}
+
+func TestHiddenColumnsIdentifyNoRows(t *testing.T) {
+	openTestDB(t, staffSchema)
+	restrictStaff()
+
+	w := serve(t, http.MethodGet, "/api/tables/events/data?limit=1&cursor=", "", "")
+	cursor, err := base64.RawURLEncoding.DecodeString(w.Header().Get("X-Next-Cursor"))
+	if err != nil || len(cursor) == 0 {
+		t.Fatalf("invalid cursor %q", w.Header().Get("X-Next-Cursor"))
+	}
+	if strings.Contains(string(cursor), "secret") || strings.Contains(string(cursor), "s1") {
+		t.Errorf("cursor reveals the hidden column: %s", cursor)
+	}
+
+	w = serve(t, http.MethodGet, "/api/odata/$metadata", "", "")
+	if !strings.Contains(w.Body.String(), `<PropertyRef Name="message"`) || strings.Contains(w.Body.String(), `"secret"`) {
+		t.Errorf("$metadata keys events by a hidden column: %s", w.Body)
+	}
+}
+
+func TestColumnRulesOfSeveralRules(t *testing.T) {
+	openTestDB(t, staffSchema)
+	restrictStaff()
+	policy.Rules = append(policy.Rules,
+		PolicyRule{Roles: []string{"*"}, Tables: []string{"*"}, Permissions: []string{permissionRead}},
+		PolicyRule{Roles: []string{"viewer"}, Tables: []string{"staff"}, Columns: []ColumnRule{{Columns: []string{"iban"}, Access: "readOnly"}}},
+		PolicyRule{Roles: []string{"admin"}, Tables: []string{"staff"}, Columns: []ColumnRule{{Columns: []string{"salary", "iban"}, Access: "full"}}},
+	)
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  map[string]columnAccess
+	}{
+		{"rule without column rules", nil, map[string]columnAccess{"id": accessReadOnly, "salary": accessHidden, "iban": accessMasked, "note": accessReadOnly}},
+		{"less restrictive rule", []string{"viewer"}, map[string]columnAccess{"id": accessReadOnly, "salary": accessHidden, "iban": accessReadOnly, "note": accessReadOnly}},
+		{"full access", []string{"admin"}, map[string]columnAccess{"id": accessReadOnly, "note": accessReadOnly}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			restrictions, err := restrictColumns(&User{Roles: test.roles}, TableRef{Schema: "main", Name: "staff"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]columnAccess)
+			for name, restriction := range restrictions {
+				got[name] = restriction.access
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if row := readRow(t, "staff", ""); row["salary"] != nil || row["iban"] != "******************3000" {
+		t.Errorf("a read rule without column rules lifts the restrictions: %v", row)
+	}
+}
@@ -14,5 +14,8 @@ func loadConfig() {
 	}
 
 	viper.AutomaticEnv()
-	viper.SetDefault("PORT", "1433")
+	viper.SetDefault("DB_DIALECT", "sqlserver")
+	viper.SetDefault("AUTH_MODE", "default")
+	viper.SetDefault("OIDC_SCOPES", "openid profile email")
+	viper.SetDefault("OIDC_ROLE_CLAIMS", "roles groups")
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// pageCursor is the content of a continuation token: the ordering it was
+// issued for and the ordering values of the last row returned. Tokens are
+// opaque to clients and only valid for the same table and sort.
+type pageCursor struct {
+	Table  string            `json:"t"`
+	Sort   []SortColumn      `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+var errInvalidCursor = errors.New("Invalid cursor")
+
+func encodeCursor(table TableRef, ordering []SortColumn, row reflect.Value) (string, error) {
+	values := convertGormStructToMap(row.Addr().Interface())
+
+	cursor := pageCursor{Table: table.String(), Sort: ordering}
+	for _, s := range ordering {
+		value, err := json.Marshal(values[s.Field])
+		if err != nil {
+			return "", err
+		}
+		cursor.Values = append(cursor.Values, value)
+	}
+
+	token, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// decodeCursor returns the last row's ordering values, bound to the column
+// types so they compare like the stored values.
+func decodeCursor(token string, table TableRef, ordering []SortColumn) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errInvalidCursor
+	}
+	if cursor.Table != table.String() || !reflect.DeepEqual(cursor.Sort, ordering) || len(cursor.Values) != len(ordering) {
+		return nil, errors.New("Cursor does not match the requested table and sort")
+	}
+
+	values := make([]interface{}, len(ordering))
+	for i, s := range ordering {
+		column, ok := lookupColumn(table, s.Field)
+		if !ok {
+			return nil, errInvalidCursor
+		}
+		if string(cursor.Values[i]) == "null" {
+			continue
+		}
+
+		value := reflect.New(goTypes[column.GoType])
+		if err := json.Unmarshal(cursor.Values[i], value.Interface()); err != nil {
+			return nil, errInvalidCursor
+		}
+		values[i] = value.Elem().Interface()
+	}
+
+	return values, nil
+}
+
+// applyCursor restricts stmt to the rows that follow the cursor in the
+// given ordering. The seek condition expands to
+//
+//	a > ? OR (a = ? AND b > ?) OR (a = ? AND b = ? AND c > ?) ...
+//
+// so that it can use an index on the ordering columns, with NULL placed
+// where the database sorts it.
+func applyCursor(stmt *gorm.DB, table TableRef, ordering []SortColumn, token string) (*gorm.DB, error) {
+	values, err := decodeCursor(token, table, ordering)
+	if err != nil {
+		return nil, err
+	}
+
+	var alternatives []string
+	var vars []interface{}
+	for i := range ordering {
+		var parts []string
+		for j := 0; j < i; j++ {
+			field := quoteColumn(db, ordering[j].Field)
+			if values[j] == nil {
+				parts = append(parts, field+" IS NULL")
+			} else {
+				parts = append(parts, field+" = ?")
+				vars = append(vars, values[j])
+			}
+		}
+
+		after, afterVars := seekAfter(quoteColumn(db, ordering[i].Field), ordering[i].Desc(), values[i])
+		parts = append(parts, after)
+		vars = append(vars, afterVars...)
+
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	if len(alternatives) == 0 {
+		return stmt, nil
+	}
+	return stmt.Where(clause.Expr{SQL: "(" + strings.Join(alternatives, " OR ") + ")", Vars: vars}), nil
+}
+
+// seekAfter renders the condition for values sorting after value.
+func seekAfter(field string, desc bool, value interface{}) (string, []interface{}) {
+	// Whether NULL comes before the other values in this direction.
+	nullsBefore := dialect.NullsFirst() != desc
+
+	if value == nil {
+		if nullsBefore {
+			return field + " IS NOT NULL", nil
+		}
+		return "1 = 0", nil
+	}
+
+	op := " > ?"
+	if desc {
+		op = " < ?"
+	}
+	if nullsBefore {
+		return field + op, []interface{}{value}
+	}
+	return "(" + field + op + " OR " + field + " IS NULL)", []interface{}{value}
+}
+
+// cursorPage trims rows, fetched with one row more than limit, to limit and
+// returns the token for the next page, or "" on the last page. limit must be
+// positive.
+func cursorPage(table TableRef, ordering []SortColumn, rows reflect.Value, limit int) (reflect.Value, string, error) {
+	if rows.Len() <= limit {
+		return rows, "", nil
+	}
+
+	rows = rows.Slice(0, limit)
+
+	token, err := encodeCursor(table, ordering, rows.Index(limit-1))
+	return rows, token, err
+}
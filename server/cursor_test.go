@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const scoresSchema = `
+CREATE TABLE scores (id INTEGER PRIMARY KEY, score INTEGER, name TEXT);
+INSERT INTO scores VALUES (1, 10, 'a'), (2, NULL, 'b'), (3, 20, 'c'), (4, 10, 'd'), (5, NULL, 'e'), (6, 30, 'f'),
+	(7, 20, NULL), (8, 10, 'h'), (9, NULL, NULL), (10, 40, 'j'), (11, 30, 'k')`
+
+func rowIDs(t *testing.T, body []byte) []int64 {
+	t.Helper()
+
+	var rows []struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]int64, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	return ids
+}
+
+func TestCursorPaging(t *testing.T) {
+	openTestDB(t, scoresSchema)
+
+	for _, sort := range []string{"", "score", "score desc", "score desc,name", "name desc,score", "name,score desc"} {
+		for _, limit := range []int{1, 2, 3, 11} {
+			t.Run(fmt.Sprintf("%q by %d", sort, limit), func(t *testing.T) {
+				w := serve(t, http.MethodGet, "/api/tables/scores/data?limit=100&sort="+url.QueryEscape(sort), "", "")
+				if w.Code != 200 {
+					t.Fatalf("got %d: %s", w.Code, w.Body)
+				}
+				want := rowIDs(t, w.Body.Bytes())
+
+				var got []int64
+				cursor := ""
+				for pages := 0; ; pages++ {
+					if pages > len(want) {
+						t.Fatalf("paging does not end, got %v so far", got)
+					}
+
+					target := fmt.Sprintf("/api/tables/scores/data?limit=%d&sort=%s&cursor=%s", limit, url.QueryEscape(sort), cursor)
+					w := serve(t, http.MethodGet, target, "", "")
+					if w.Code != 200 {
+						t.Fatalf("got %d: %s", w.Code, w.Body)
+					}
+					got = append(got, rowIDs(t, w.Body.Bytes())...)
+
+					cursor = w.Header().Get("X-Next-Cursor")
+					if cursor == "" {
+						break
+					}
+				}
+
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestQueryCursorPaging(t *testing.T) {
+	openTestDB(t, scoresSchema)
+
+	var got []int64
+	cursor := ""
+	for {
+		body := fmt.Sprintf(`{"limit": 4, "cursor": %q, "sort": [{"field": "score", "direction": "desc"}],
+			"where": {"field": "score", "type": "notBlank"}}`, cursor)
+		w := serve(t, http.MethodPost, "/api/tables/scores/query", body, "")
+		if w.Code != 200 {
+			t.Fatalf("got %d: %s", w.Code, w.Body)
+		}
+
+		var page struct {
+			Data       json.RawMessage `json:"data"`
+			Count      int64           `json:"count"`
+			NextCursor string          `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		if page.Count != 8 {
+			t.Errorf("got count %d, want 8", page.Count)
+		}
+		got = append(got, rowIDs(t, page.Data)...)
+
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+
+	want := []int64{10, 6, 11, 3, 7, 1, 4, 8}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestInvalidCursor(t *testing.T) {
+	openTestDB(t, scoresSchema)
+
+	w := serve(t, http.MethodGet, "/api/tables/scores/data?limit=2&sort=score&cursor=", "", "")
+	cursor := w.Header().Get("X-Next-Cursor")
+	if cursor == "" {
+		t.Fatal("missing X-Next-Cursor")
+	}
+
+	for _, target := range []string{
+		"/api/tables/scores/data?limit=2&sort=score+desc&cursor=" + cursor,
+		"/api/tables/scores/data?limit=2&sort=name&cursor=" + cursor,
+		"/api/tables/scores/data?limit=2&sort=score&cursor=not-a-cursor",
+	} {
+		if w := serve(t, http.MethodGet, target, "", ""); w.Code != 400 {
+			t.Errorf("%s: got %d, want 400", target, w.Code)
+		}
+	}
+}
+
+func TestInvalidLimit(t *testing.T) {
+	openTestDB(t, scoresSchema)
+
+	for _, target := range []string{
+		"/api/tables/scores/data?limit=-1&cursor=",
+		"/api/tables/scores/data?limit=0",
+		"/api/tables/scores/data?limit=x",
+	} {
+		if w := serve(t, http.MethodGet, target, "", ""); w.Code != 400 {
+			t.Errorf("%s: got %d, want 400", target, w.Code)
+		}
+	}
+
+	for _, body := range []string{`{"limit": -1, "cursor": ""}`, `{"limit": -5}`} {
+		if w := serve(t, http.MethodPost, "/api/tables/scores/query", body, ""); w.Code != 400 {
+			t.Errorf("%s: got %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestCursorPagingWithoutPrimaryKey(t *testing.T) {
+	openTestDB(t, `
+		CREATE TABLE tags (a INTEGER, b TEXT);
+		INSERT INTO tags VALUES (1, 'x'), (1, 'y'), (2, 'z'), (NULL, 'w'), (1, NULL)`)
+
+	for _, sort := range []string{"", "a", "a desc", "b"} {
+		t.Run(sort, func(t *testing.T) {
+			var got []string
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > 5 {
+					t.Fatalf("paging does not end, got %v so far", got)
+				}
+
+				target := "/api/tables/tags/data?limit=1&sort=" + url.QueryEscape(sort) + "&cursor=" + cursor
+				w := serve(t, http.MethodGet, target, "", "")
+				if w.Code != 200 {
+					t.Fatalf("got %d: %s", w.Code, w.Body)
+				}
+				var rows []struct {
+					A *int64  `json:"a"`
+					B *string `json:"b"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &rows)
+				for _, row := range rows {
+					got = append(got, fmt.Sprint(row.A, row.B))
+				}
+
+				if cursor = w.Header().Get("X-Next-Cursor"); cursor == "" {
+					break
+				}
+			}
+
+			if len(got) != 5 {
+				t.Errorf("got %d of 5 rows", len(got))
+			}
+		})
+	}
+
+	w := serve(t, http.MethodGet, "/api/odata/$metadata", "", "")
+	if !strings.Contains(w.Body.String(), `<PropertyRef Name="a">`) || !strings.Contains(w.Body.String(), `<PropertyRef Name="b">`) {
+		t.Errorf("$metadata does not key tags by all its columns: %s", w.Body)
+	}
+}
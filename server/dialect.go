@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Dialect hides everything that differs between the supported database
+// engines: how to open a connection, how to read the catalog and how the
+// native column types map onto Go and frontend types.
+type Dialect interface {
+	Name() string
+	Open() (gorm.Dialector, error)
+	DefaultSchema(db *gorm.DB) (string, error)
+	Tables(db *gorm.DB) ([]TableInfo, error)
+	Columns(db *gorm.DB, table TableRef) ([]SchemaColumn, error)
+	ForeignKey(db *gorm.DB, schema string, foreignKeyName string) (FkMapping, error)
+	MapType(dbType string) (goType string, frontendType string)
+	// Regexp renders a condition matching column against a regular expression
+	// bound to a single placeholder. ok is false where the engine has none.
+	Regexp(column string) (condition string, ok bool)
+	// NullsFirst reports whether NULL sorts before every other value in
+	// ascending order.
+	NullsFirst() bool
+	// RowLock returns the table hint and the statement suffix that lock the
+	// rows read by a SELECT until the end of the transaction.
+	RowLock() (hint string, suffix string)
+	// Insert adds a row and scans the returning columns of the stored row,
+	// including database generated values, into dest.
+	Insert(tx *gorm.DB, table TableRef, columns []SchemaColumn, values map[string]interface{}, returning []string, dest interface{}) error
+	// Update sets values on the rows matching where and scans the returning
+	// columns of the updated row into dest. It reports the number of rows
+	// matched.
+	Update(tx *gorm.DB, table TableRef, values map[string]interface{}, where map[string]interface{}, returning []string, dest interface{}) (int64, error)
+}
+
+var dialect Dialect
+
+func selectDialect(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case "", "sqlserver", "mssql":
+		return sqlServerDialect{}, nil
+	case "postgres", "postgresql":
+		return postgresDialect{}, nil
+	case "mysql", "mariadb":
+		return mysqlDialect{}, nil
+	case "sqlite", "sqlite3":
+		return sqliteDialect{}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported database dialect %q", name)
+}
+
+// baseType strips length, precision and modifiers from a catalog type name,
+// e.g. "VARCHAR(50)" becomes "varchar" and "double precision" stays intact.
+func baseType(dbType string) string {
+	dbType = strings.ToLower(strings.TrimSpace(dbType))
+	if i := strings.Index(dbType, "("); i >= 0 {
+		dbType = strings.TrimSpace(dbType[:i])
+	}
+	return dbType
+}
+
+// scanForeignKey runs a catalog query returning the FOREIGN_KEY_NAME,
+// FOREIGN_TABLE, FOREIGN_COLUMN, REFERENCED_SCHEMA, REFERENCED_TABLE and
+// REFERENCED_COLUMN columns for the given constraint.
+func scanForeignKey(db *gorm.DB, query string, schema string, foreignKeyName string) (FkMapping, error) {
+	type ForeignKey struct {
+		ForeignKeyName   string `gorm:"column:FOREIGN_KEY_NAME"`
+		ForeignTable     string `gorm:"column:FOREIGN_TABLE"`
+		ForeignColumn    string `gorm:"column:FOREIGN_COLUMN"`
+		ReferencedSchema string `gorm:"column:REFERENCED_SCHEMA"`
+		ReferencedTable  string `gorm:"column:REFERENCED_TABLE"`
+		ReferencedColumn string `gorm:"column:REFERENCED_COLUMN"`
+	}
+
+	var foreignKeys ForeignKey
+	result := db.Raw(query, schema, foreignKeyName).Find(&foreignKeys)
+	if result.Error != nil {
+		return FkMapping{}, result.Error
+	}
+	if foreignKeys.ReferencedTable == "" {
+		return FkMapping{}, nil
+	}
+
+	fkMap := FkMapping{
+		ReferencedTable:  TableRef{Schema: foreignKeys.ReferencedSchema, Name: foreignKeys.ReferencedTable},
+		ReferencedColumn: foreignKeys.ReferencedColumn,
+	}
+
+	return fkMap, nil
+}
+
+func quoteTable(tx *gorm.DB, table TableRef) string {
+	return tx.Statement.Quote(clause.Table{Name: table.Schema}) + "." + tx.Statement.Quote(clause.Table{Name: table.Name})
+}
+
+func quoteColumn(tx *gorm.DB, column string) string {
+	return tx.Statement.Quote(clause.Column{Name: column})
+}
+
+// insertClauses renders the column list and VALUES clause of an INSERT in
+// a stable column order. An empty row falls back to DEFAULT VALUES.
+func insertClauses(tx *gorm.DB, values map[string]interface{}) (string, string, []interface{}) {
+	if len(values) == 0 {
+		return "", "DEFAULT VALUES", nil
+	}
+
+	names := sortedKeys(values)
+
+	quoted := make([]string, len(names))
+	placeholders := make([]string, len(names))
+	vars := make([]interface{}, len(names))
+	for i, name := range names {
+		quoted[i] = quoteColumn(tx, name)
+		placeholders[i] = "?"
+		vars[i] = values[name]
+	}
+
+	return "(" + strings.Join(quoted, ", ") + ")", "VALUES (" + strings.Join(placeholders, ", ") + ")", vars
+}
+
+// insertReturning implements Insert for dialects with a RETURNING clause.
+func insertReturning(tx *gorm.DB, table TableRef, values map[string]interface{}, returning []string, dest interface{}) error {
+	columnList, valuesClause, vars := insertClauses(tx, values)
+
+	query := "INSERT INTO " + quoteTable(tx, table) + " " + columnList + " " + valuesClause
+	if len(returning) > 0 {
+		query += " RETURNING " + quoteColumns(tx, returning, "")
+		return tx.Raw(query, vars...).Scan(dest).Error
+	}
+	return tx.Exec(query, vars...).Error
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func quoteColumns(tx *gorm.DB, columns []string, prefix string) string {
+	quoted := make([]string, len(columns))
+	for i, name := range columns {
+		quoted[i] = prefix + quoteColumn(tx, name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// setClause renders "a = ?, b = ?" for an UPDATE.
+func setClause(tx *gorm.DB, values map[string]interface{}) (string, []interface{}) {
+	var assignments []string
+	var vars []interface{}
+	for _, name := range sortedKeys(values) {
+		assignments = append(assignments, quoteColumn(tx, name)+" = ?")
+		vars = append(vars, values[name])
+	}
+	return strings.Join(assignments, ", "), vars
+}
+
+// errNoRowKey is returned for writes and row reads without key values, which
+// would otherwise affect every row of the table.
+var errNoRowKey = errors.New("cannot identify a row without primary key values")
+
+// whereClause renders "a = ? AND b = ?" matching every given column value.
+// It identifies single rows, so where may not be empty.
+func whereClause(tx *gorm.DB, where map[string]interface{}) (string, []interface{}, error) {
+	var conditions []string
+	var vars []interface{}
+	for _, name := range sortedKeys(where) {
+		if where[name] == nil {
+			conditions = append(conditions, quoteColumn(tx, name)+" IS NULL")
+			continue
+		}
+		conditions = append(conditions, quoteColumn(tx, name)+" = ?")
+		vars = append(vars, where[name])
+	}
+	if len(conditions) == 0 {
+		return "", nil, errNoRowKey
+	}
+	return strings.Join(conditions, " AND "), vars, nil
+}
+
+// selectRow reads the returning columns of the row matching where, used
+// where a dialect cannot return the row from the write itself.
+func selectRow(tx *gorm.DB, table TableRef, where map[string]interface{}, returning []string, dest interface{}) (int64, error) {
+	condition, vars, err := whereClause(tx, where)
+	if err != nil {
+		return 0, err
+	}
+	query := "SELECT " + quoteColumns(tx, returning, "") + " FROM " + quoteTable(tx, table) + " WHERE " + condition
+	result := tx.Raw(query, vars...).Scan(dest)
+	return result.RowsAffected, result.Error
+}
+
+// lockRow reads the row matching where like selectRow and locks it until the
+// end of the transaction.
+func lockRow(tx *gorm.DB, table TableRef, where map[string]interface{}, returning []string, dest interface{}) (int64, error) {
+	hint, suffix := dialect.RowLock()
+	condition, vars, err := whereClause(tx, where)
+	if err != nil {
+		return 0, err
+	}
+	query := "SELECT " + quoteColumns(tx, returning, "") + " FROM " + quoteTable(tx, table) + hint + " WHERE " + condition + suffix
+	result := tx.Raw(query, vars...).Scan(dest)
+	return result.RowsAffected, result.Error
+}
+
+// updateReturning implements Update for dialects with a RETURNING clause.
+func updateReturning(tx *gorm.DB, table TableRef, values map[string]interface{}, where map[string]interface{}, returning []string, dest interface{}) (int64, error) {
+	if len(values) == 0 {
+		return selectRow(tx, table, where, returning, dest)
+	}
+
+	assignments, vars := setClause(tx, values)
+	condition, whereVars, err := whereClause(tx, where)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "UPDATE " + quoteTable(tx, table) + " SET " + assignments + " WHERE " + condition
+	if len(returning) == 0 {
+		result := tx.Exec(query, append(vars, whereVars...)...)
+		return result.RowsAffected, result.Error
+	}
+
+	query += " RETURNING " + quoteColumns(tx, returning, "")
+	result := tx.Raw(query, append(vars, whereVars...)...).Scan(dest)
+	return result.RowsAffected, result.Error
+}
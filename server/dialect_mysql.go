@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect) Open() (gorm.Dialector, error) {
+	server := viper.GetString("SERVER")
+	database := viper.GetString("DATABASE")
+	port := viper.GetInt("PORT")
+	if port == 0 {
+		port = 3306
+	}
+
+	if server == "" || database == "" {
+		return nil, errors.New("missing required environment variables")
+	}
+
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
+		viper.GetString("DB_USER"), viper.GetString("DB_PASSWORD"), server, port, database)
+
+	return mysql.Open(dsn), nil
+}
+
+// DefaultSchema is the connected database, since MySQL treats schemas and
+// databases as the same thing.
+func (mysqlDialect) DefaultSchema(db *gorm.DB) (string, error) {
+	var schema string
+	err := db.Raw("SELECT DATABASE()").Scan(&schema).Error
+	return schema, err
+}
+
+func (mysqlDialect) Tables(db *gorm.DB) ([]TableInfo, error) {
+	query := `
+	SELECT
+		TABLE_SCHEMA AS ` + "`Schema`" + `,
+		TABLE_NAME AS Name,
+		CASE WHEN TABLE_TYPE = 'VIEW' THEN 'view' ELSE 'table' END AS Type
+	FROM INFORMATION_SCHEMA.TABLES
+	WHERE TABLE_TYPE IN ('BASE TABLE', 'VIEW')
+		AND TABLE_SCHEMA NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys')
+	ORDER BY TABLE_SCHEMA, TABLE_NAME;
+	`
+
+	var tables []TableInfo
+	err := db.Raw(query).Scan(&tables).Error
+	return tables, err
+}
+
+func (mysqlDialect) Columns(db *gorm.DB, table TableRef) ([]SchemaColumn, error) {
+	query := `
+		SELECT
+			c.COLUMN_NAME AS DbName,
+			c.DATA_TYPE AS DbType,
+			CASE WHEN c.IS_NULLABLE = 'YES' THEN 1 ELSE 0 END AS Nullable,
+			c.ORDINAL_POSITION AS Ordinal,
+			c.CHARACTER_MAXIMUM_LENGTH AS MaxLength,
+			COALESCE(c.NUMERIC_PRECISION, c.DATETIME_PRECISION) AS ` + "`Precision`" + `,
+			c.NUMERIC_SCALE AS Scale,
+			c.COLUMN_DEFAULT AS ` + "`Default`" + `,
+			c.EXTRA LIKE '%auto_increment%' AS Identity,
+			c.EXTRA LIKE '%GENERATED%' AS Computed,
+			MAX(CASE WHEN tc.CONSTRAINT_TYPE = 'PRIMARY KEY' THEN 1 ELSE 0 END) AS ` + "`Key`" + `,
+			MAX(CASE WHEN tc.CONSTRAINT_TYPE = 'FOREIGN KEY' THEN k.CONSTRAINT_NAME END) AS ForeignKey
+		FROM INFORMATION_SCHEMA.COLUMNS c
+		LEFT JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE k
+			ON c.TABLE_NAME = k.TABLE_NAME
+			AND c.COLUMN_NAME = k.COLUMN_NAME
+			AND c.TABLE_SCHEMA = k.TABLE_SCHEMA
+		LEFT JOIN INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc
+			ON k.TABLE_NAME = tc.TABLE_NAME
+			AND k.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+			AND k.TABLE_SCHEMA = tc.TABLE_SCHEMA
+			AND tc.CONSTRAINT_TYPE IN ('PRIMARY KEY', 'FOREIGN KEY')
+		WHERE c.TABLE_SCHEMA = ? AND c.TABLE_NAME = ?
+		GROUP BY c.COLUMN_NAME, c.DATA_TYPE, c.IS_NULLABLE, c.ORDINAL_POSITION, c.CHARACTER_MAXIMUM_LENGTH,
+			c.NUMERIC_PRECISION, c.DATETIME_PRECISION, c.NUMERIC_SCALE, c.COLUMN_DEFAULT, c.EXTRA
+		ORDER BY c.ORDINAL_POSITION;
+	`
+
+	var columns []SchemaColumn
+	err := db.Raw(query, table.Schema, table.Name).Scan(&columns).Error
+	return columns, err
+}
+
+func (mysqlDialect) ForeignKey(db *gorm.DB, schema string, foreignKeyName string) (FkMapping, error) {
+	query := `
+	SELECT
+		CONSTRAINT_NAME AS FOREIGN_KEY_NAME,
+		TABLE_NAME AS FOREIGN_TABLE,
+		COLUMN_NAME AS FOREIGN_COLUMN,
+		REFERENCED_TABLE_SCHEMA AS REFERENCED_SCHEMA,
+		REFERENCED_TABLE_NAME AS REFERENCED_TABLE,
+		REFERENCED_COLUMN_NAME AS REFERENCED_COLUMN
+	FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE
+	WHERE CONSTRAINT_SCHEMA = ?
+		AND CONSTRAINT_NAME = ?
+		AND REFERENCED_TABLE_NAME IS NOT NULL;
+	`
+
+	return scanForeignKey(db, query, schema, foreignKeyName)
+}
+
+func (mysqlDialect) MapType(dbType string) (string, string) {
+	switch baseType(dbType) {
+	case "int", "integer", "bigint", "smallint", "tinyint", "mediumint", "year":
+		return "int", "number"
+	case "decimal", "numeric":
+		return "decimal", "number"
+	case "float", "double":
+		return "float", "number"
+	case "bool", "boolean":
+		return "bool", "boolean"
+	case "date":
+		return "date", "date"
+	case "datetime", "timestamp":
+		return "datetime", "datetime"
+	case "time":
+		return "time", "text"
+	case "binary", "varbinary", "blob", "tinyblob", "mediumblob", "longblob":
+		return "binary", "text"
+	case "char", "varchar", "text", "tinytext", "mediumtext", "longtext", "enum", "set", "json":
+		return "string", "text"
+	}
+
+	return "interface{}", dbType
+}
+
+func (mysqlDialect) Regexp(column string) (string, bool) {
+	return column + " REGEXP ?", true
+}
+
+func (mysqlDialect) NullsFirst() bool {
+	return true
+}
+
+func (mysqlDialect) RowLock() (string, string) {
+	return "", " FOR UPDATE"
+}
+
+// Insert emulates RETURNING, which MySQL lacks, by reading the row back
+// through LAST_INSERT_ID() or the supplied key values on the same connection.
+func (mysqlDialect) Insert(tx *gorm.DB, table TableRef, columns []SchemaColumn, values map[string]interface{}, returning []string, dest interface{}) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		columnList, valuesClause, vars := insertClauses(tx, values)
+		if len(values) == 0 {
+			valuesClause = "VALUES ()"
+		}
+
+		err := tx.Exec("INSERT INTO "+quoteTable(tx, table)+" "+columnList+" "+valuesClause, vars...).Error
+		if err != nil || len(returning) == 0 {
+			return err
+		}
+
+		conditions := make(map[string]interface{})
+		for _, col := range columns {
+			if col.Identity {
+				var id int64
+				if err := tx.Raw("SELECT LAST_INSERT_ID()").Scan(&id).Error; err != nil {
+					return err
+				}
+				conditions[col.DbName] = id
+			} else if col.Key {
+				conditions[col.DbName] = values[col.DbName]
+			}
+		}
+		if len(conditions) == 0 {
+			return errors.New("cannot read back a row without primary key")
+		}
+
+		_, err = selectRow(tx, table, conditions, returning, dest)
+		return err
+	})
+}
+
+// Update reads the row back after updating it, since MySQL has no RETURNING.
+// The key columns in where are assumed unchanged by values.
+func (mysqlDialect) Update(tx *gorm.DB, table TableRef, values map[string]interface{}, where map[string]interface{}, returning []string, dest interface{}) (int64, error) {
+	var rowsAffected int64
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		if len(values) > 0 {
+			assignments, vars := setClause(tx, values)
+			condition, whereVars, err := whereClause(tx, where)
+			if err != nil {
+				return err
+			}
+
+			err = tx.Exec("UPDATE "+quoteTable(tx, table)+" SET "+assignments+" WHERE "+condition, append(vars, whereVars...)...).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		var err error
+		rowsAffected, err = selectRow(tx, table, where, returning, dest)
+		return err
+	})
+	return rowsAffected, err
+}
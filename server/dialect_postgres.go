@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (postgresDialect) Open() (gorm.Dialector, error) {
+	server := viper.GetString("SERVER")
+	database := viper.GetString("DATABASE")
+	port := viper.GetInt("PORT")
+	if port == 0 {
+		port = 5432
+	}
+
+	if server == "" || database == "" {
+		return nil, errors.New("missing required environment variables")
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%d dbname=%s", server, port, database)
+	if user := viper.GetString("DB_USER"); user != "" {
+		dsn += fmt.Sprintf(" user=%s", user)
+	}
+	if password := viper.GetString("DB_PASSWORD"); password != "" {
+		dsn += fmt.Sprintf(" password=%s", password)
+	}
+	if sslMode := viper.GetString("DB_SSLMODE"); sslMode != "" {
+		dsn += fmt.Sprintf(" sslmode=%s", sslMode)
+	}
+
+	return postgres.Open(dsn), nil
+}
+
+func (postgresDialect) DefaultSchema(db *gorm.DB) (string, error) {
+	var schema string
+	err := db.Raw("SELECT current_schema()").Scan(&schema).Error
+	return schema, err
+}
+
+func (postgresDialect) Tables(db *gorm.DB) ([]TableInfo, error) {
+	query := `
+	SELECT
+		table_schema AS "Schema",
+		table_name AS "Name",
+		CASE WHEN table_type = 'VIEW' THEN 'view' ELSE 'table' END AS "Type"
+	FROM information_schema.tables
+	WHERE table_type IN ('BASE TABLE', 'VIEW')
+		AND table_schema NOT IN ('pg_catalog', 'information_schema')
+	ORDER BY table_schema, table_name;
+	`
+
+	var tables []TableInfo
+	err := db.Raw(query).Scan(&tables).Error
+	return tables, err
+}
+
+func (postgresDialect) Columns(db *gorm.DB, table TableRef) ([]SchemaColumn, error) {
+	query := `
+		SELECT
+			c.column_name AS "DbName",
+			c.data_type AS "DbType",
+			c.is_nullable = 'YES' AS "Nullable",
+			c.ordinal_position AS "Ordinal",
+			c.character_maximum_length AS "MaxLength",
+			COALESCE(c.numeric_precision, c.datetime_precision) AS "Precision",
+			c.numeric_scale AS "Scale",
+			c.column_default AS "Default",
+			c.is_identity = 'YES' OR COALESCE(c.column_default, '') LIKE 'nextval(%' AS "Identity",
+			c.is_generated = 'ALWAYS' AS "Computed",
+			MAX(CASE WHEN tc.constraint_type = 'PRIMARY KEY' THEN 1 ELSE 0 END) = 1 AS "Key",
+			MAX(CASE WHEN tc.constraint_type = 'FOREIGN KEY' THEN k.constraint_name END) AS "ForeignKey"
+		FROM information_schema.columns c
+		LEFT JOIN information_schema.key_column_usage k
+			ON c.table_name = k.table_name
+			AND c.column_name = k.column_name
+			AND c.table_schema = k.table_schema
+		LEFT JOIN information_schema.table_constraints tc
+			ON k.table_name = tc.table_name
+			AND k.constraint_name = tc.constraint_name
+			AND k.table_schema = tc.table_schema
+			AND tc.constraint_type IN ('PRIMARY KEY', 'FOREIGN KEY')
+		WHERE c.table_schema = ? AND c.table_name = ?
+		GROUP BY c.column_name, c.data_type, c.is_nullable, c.ordinal_position, c.character_maximum_length,
+			c.numeric_precision, c.datetime_precision, c.numeric_scale, c.column_default, c.is_identity, c.is_generated
+		ORDER BY c.ordinal_position;
+	`
+
+	var columns []SchemaColumn
+	err := db.Raw(query, table.Schema, table.Name).Scan(&columns).Error
+	return columns, err
+}
+
+func (postgresDialect) ForeignKey(db *gorm.DB, schema string, foreignKeyName string) (FkMapping, error) {
+	query := `
+	SELECT
+		fk.constraint_name AS "FOREIGN_KEY_NAME",
+		fk.table_name AS "FOREIGN_TABLE",
+		fk.column_name AS "FOREIGN_COLUMN",
+		pk.table_schema AS "REFERENCED_SCHEMA",
+		pk.table_name AS "REFERENCED_TABLE",
+		pk.column_name AS "REFERENCED_COLUMN"
+	FROM information_schema.key_column_usage fk
+	JOIN information_schema.referential_constraints rc
+		ON fk.constraint_name = rc.constraint_name
+		AND fk.constraint_schema = rc.constraint_schema
+	JOIN information_schema.key_column_usage pk
+		ON pk.constraint_name = rc.unique_constraint_name
+		AND pk.constraint_schema = rc.unique_constraint_schema
+		AND pk.ordinal_position = fk.position_in_unique_constraint
+	WHERE fk.constraint_schema = ? AND fk.constraint_name = ?;
+	`
+
+	return scanForeignKey(db, query, schema, foreignKeyName)
+}
+
+func (postgresDialect) MapType(dbType string) (string, string) {
+	switch baseType(dbType) {
+	case "integer", "bigint", "smallint":
+		return "int", "number"
+	case "numeric", "decimal":
+		return "decimal", "number"
+	case "real", "double precision":
+		return "float", "number"
+	case "boolean":
+		return "bool", "boolean"
+	case "date":
+		return "date", "date"
+	case "timestamp without time zone", "timestamp with time zone":
+		return "datetime", "datetime"
+	case "time without time zone":
+		return "time", "text"
+	case "uuid":
+		return "guid", "text"
+	case "bytea":
+		return "binary", "text"
+	case "character", "character varying", "text", "char", "varchar", "money", "json", "jsonb", "xml":
+		return "string", "text"
+	}
+
+	return "interface{}", dbType
+}
+
+func (postgresDialect) Regexp(column string) (string, bool) {
+	return column + " ~ ?", true
+}
+
+func (postgresDialect) NullsFirst() bool {
+	return false
+}
+
+func (postgresDialect) RowLock() (string, string) {
+	return "", " FOR UPDATE"
+}
+
+func (postgresDialect) Insert(tx *gorm.DB, table TableRef, columns []SchemaColumn, values map[string]interface{}, returning []string, dest interface{}) error {
+	return insertReturning(tx, table, values, returning, dest)
+}
+
+func (postgresDialect) Update(tx *gorm.DB, table TableRef, values map[string]interface{}, where map[string]interface{}, returning []string, dest interface{}) (int64, error) {
+	return updateReturning(tx, table, values, where, returning, dest)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	gosqlite "github.com/glebarez/go-sqlite"
+	"github.com/glebarez/sqlite"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) Open() (gorm.Dialector, error) {
+	database := viper.GetString("DATABASE")
+	if database == "" {
+		return nil, errors.New("missing required environment variables")
+	}
+
+	registerSqliteRegexp.Do(func() {
+		gosqlite.MustRegisterDeterministicScalarFunction("regexp", 2, sqliteRegexp)
+	})
+
+	return sqlite.Open(database + "?_pragma=foreign_keys(1)"), nil
+}
+
+var (
+	registerSqliteRegexp sync.Once
+	sqliteRegexpCache    sync.Map
+)
+
+// sqliteRegexp implements "value REGEXP pattern", which SQLite evaluates as
+// regexp(pattern, value). NULL values never match.
+func sqliteRegexp(ctx *gosqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	pattern := fmt.Sprint(args[0])
+	compiled, ok := sqliteRegexpCache.Load(pattern)
+	if !ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled, _ = sqliteRegexpCache.LoadOrStore(pattern, re)
+	}
+
+	var value string
+	switch v := args[1].(type) {
+	case []byte:
+		value = string(v)
+	default:
+		value = fmt.Sprint(v)
+	}
+	return compiled.(*regexp.Regexp).MatchString(value), nil
+}
+
+// DefaultSchema is always "main", the name SQLite gives the opened database
+// file. Attached databases are not listed.
+func (sqliteDialect) DefaultSchema(db *gorm.DB) (string, error) {
+	return "main", nil
+}
+
+func (sqliteDialect) Tables(db *gorm.DB) ([]TableInfo, error) {
+	query := `
+	SELECT 'main' AS Schema, name AS Name, type AS Type
+	FROM sqlite_master
+	WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'
+	ORDER BY name
+	`
+
+	var tables []TableInfo
+	err := db.Raw(query).Scan(&tables).Error
+	return tables, err
+}
+
+// sqliteForeignKey is a row of pragma_foreign_key_list. SQLite does not name
+// foreign keys, so a stable name is derived from the owning table and column.
+type sqliteForeignKey struct {
+	Table string `gorm:"column:table"`
+	From  string `gorm:"column:from"`
+	To    string `gorm:"column:to"`
+}
+
+func sqliteForeignKeyName(table string, column string) string {
+	return "FK_" + table + "_" + column
+}
+
+func sqliteForeignKeys(db *gorm.DB, table TableRef) ([]sqliteForeignKey, error) {
+	var foreignKeys []sqliteForeignKey
+	err := db.Raw(`SELECT "table", "from", "to" FROM pragma_foreign_key_list(?, ?)`, table.Name, table.Schema).
+		Scan(&foreignKeys).Error
+	return foreignKeys, err
+}
+
+func (d sqliteDialect) Columns(db *gorm.DB, table TableRef) ([]SchemaColumn, error) {
+	type pragmaColumn struct {
+		Cid     int     `gorm:"column:cid"`
+		Name    string  `gorm:"column:name"`
+		Type    string  `gorm:"column:type"`
+		Pk      int     `gorm:"column:pk"`
+		NotNull int     `gorm:"column:notnull"`
+		Default *string `gorm:"column:dflt_value"`
+		Hidden  int     `gorm:"column:hidden"`
+	}
+
+	query := `SELECT cid, name, type, pk, "notnull", dflt_value, hidden FROM pragma_table_xinfo(?, ?) ORDER BY cid`
+
+	var pragmaColumns []pragmaColumn
+	err := db.Raw(query, table.Name, table.Schema).Scan(&pragmaColumns).Error
+	if err != nil {
+		return nil, err
+	}
+
+	keyCount := 0
+	for _, col := range pragmaColumns {
+		if col.Pk > 0 {
+			keyCount++
+		}
+	}
+
+	foreignKeys, err := sqliteForeignKeys(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	fkByColumn := make(map[string]string)
+	for _, fk := range foreignKeys {
+		fkByColumn[fk.From] = sqliteForeignKeyName(table.Name, fk.From)
+	}
+
+	var columns []SchemaColumn
+	for _, col := range pragmaColumns {
+		// Hidden columns of virtual tables are not part of the row.
+		if col.Hidden == 1 {
+			continue
+		}
+
+		column := SchemaColumn{
+			DbName:     col.Name,
+			DbType:     col.Type,
+			Key:        col.Pk > 0,
+			Nullable:   col.NotNull == 0 && col.Pk == 0,
+			ForeignKey: fkByColumn[col.Name],
+			Ordinal:    col.Cid + 1,
+			Default:    col.Default,
+			// A single INTEGER PRIMARY KEY aliases the rowid and is assigned
+			// automatically.
+			Identity: col.Pk > 0 && keyCount == 1 && strings.EqualFold(col.Type, "INTEGER"),
+			Computed: col.Hidden == 2 || col.Hidden == 3,
+		}
+
+		if match := sqliteTypeArgs.FindStringSubmatch(col.Type); match != nil {
+			first, _ := strconv.ParseInt(match[1], 10, 64)
+			if goType, _ := d.MapType(col.Type); goType == "string" {
+				column.MaxLength = &first
+			} else {
+				column.Precision = &first
+				if match[2] != "" {
+					scale, _ := strconv.ParseInt(match[2], 10, 64)
+					column.Scale = &scale
+				}
+			}
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
+
+// sqliteTypeArgs extracts the length or precision and scale from declared
+// types such as VARCHAR(50) or DECIMAL(10, 2).
+var sqliteTypeArgs = regexp.MustCompile(`\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\)`)
+
+func (d sqliteDialect) ForeignKey(db *gorm.DB, schema string, foreignKeyName string) (FkMapping, error) {
+	tables, err := d.Tables(db)
+	if err != nil {
+		return FkMapping{}, err
+	}
+
+	for _, table := range tables {
+		if table.Type != "table" || table.Schema != schema || !strings.HasPrefix(foreignKeyName, "FK_"+table.Name+"_") {
+			continue
+		}
+
+		foreignKeys, err := sqliteForeignKeys(db, table.TableRef)
+		if err != nil {
+			return FkMapping{}, err
+		}
+
+		for _, fk := range foreignKeys {
+			if sqliteForeignKeyName(table.Name, fk.From) == foreignKeyName {
+				referenced := TableRef{Schema: table.Schema, Name: fk.Table}
+				return FkMapping{ReferencedTable: referenced, ReferencedColumn: fk.To}, nil
+			}
+		}
+	}
+
+	return FkMapping{}, nil
+}
+
+// MapType follows SQLite's type affinity rules, since declared column types
+// are free text.
+func (sqliteDialect) MapType(dbType string) (string, string) {
+	upper := strings.ToUpper(dbType)
+	switch {
+	case strings.Contains(upper, "INT"):
+		return "int", "number"
+	case strings.Contains(upper, "CHAR"), strings.Contains(upper, "CLOB"), strings.Contains(upper, "TEXT"):
+		return "string", "text"
+	case strings.Contains(upper, "BLOB"):
+		return "binary", "text"
+	case strings.Contains(upper, "REAL"), strings.Contains(upper, "FLOA"), strings.Contains(upper, "DOUB"):
+		return "float", "number"
+	case strings.Contains(upper, "BOOL"):
+		return "bool", "boolean"
+	case strings.Contains(upper, "DATETIME"), strings.Contains(upper, "TIMESTAMP"):
+		return "datetime", "datetime"
+	case strings.Contains(upper, "DATE"):
+		return "date", "date"
+	case strings.Contains(upper, "TIME"):
+		return "time", "text"
+	case strings.Contains(upper, "NUMERIC"), strings.Contains(upper, "DECIMAL"):
+		return "decimal", "number"
+	}
+
+	return "interface{}", strings.ToLower(dbType)
+}
+
+// Regexp relies on the regexp function registered in Open; SQLite itself
+// only reserves the operator.
+func (sqliteDialect) Regexp(column string) (string, bool) {
+	return column + " REGEXP ?", true
+}
+
+func (sqliteDialect) NullsFirst() bool {
+	return true
+}
+
+// SQLite locks the whole database for writes, so rows need no lock of
+// their own.
+func (sqliteDialect) RowLock() (string, string) {
+	return "", ""
+}
+
+func (sqliteDialect) Insert(tx *gorm.DB, table TableRef, columns []SchemaColumn, values map[string]interface{}, returning []string, dest interface{}) error {
+	return insertReturning(tx, table, values, returning, dest)
+}
+
+func (sqliteDialect) Update(tx *gorm.DB, table TableRef, values map[string]interface{}, where map[string]interface{}, returning []string, dest interface{}) (int64, error) {
+	return updateReturning(tx, table, values, where, returning, dest)
+}
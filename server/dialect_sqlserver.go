@@ -0,0 +1,353 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/microsoft/go-mssqldb/azuread"
+	"github.com/spf13/viper"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+)
+
+type sqlServerDialect struct{}
+
+func (sqlServerDialect) Name() string {
+	return "sqlserver"
+}
+
+func (sqlServerDialect) Open() (gorm.Dialector, error) {
+	driverName, connString, err := sqlServerConnectionString()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(driverName, connString)
+	if err != nil {
+		return nil, err
+	}
+
+	config := sqlserver.Config{DriverName: driverName, DSN: connString, Conn: db}
+
+	return sqlserver.New(config), nil
+}
+
+// sqlServerConnectionString builds the driver name and DSN for the configured
+// AUTH_MODE. Every mode except connection_string needs SERVER and DATABASE.
+func sqlServerConnectionString() (string, string, error) {
+	authMode := strings.ToLower(viper.GetString("AUTH_MODE"))
+
+	if authMode == "connection_string" {
+		connString := viper.GetString("DB_CONNECTION_STRING")
+		if connString == "" {
+			return "", "", errors.New("AUTH_MODE connection_string requires DB_CONNECTION_STRING")
+		}
+		return azuread.DriverName, connString, nil
+	}
+
+	server := viper.GetString("SERVER")
+	database := viper.GetString("DATABASE")
+	port := viper.GetInt("PORT")
+	if port == 0 {
+		port = 1433
+	}
+
+	if server == "" || database == "" {
+		return "", "", errors.New("missing required environment variables SERVER and DATABASE")
+	}
+
+	query := url.Values{}
+	query.Set("database", database)
+
+	connURL := url.URL{
+		Scheme: "sqlserver",
+		Host:   fmt.Sprintf("%s:%d", server, port),
+	}
+
+	switch authMode {
+	case "", "default":
+		query.Set("fedauth", azuread.ActiveDirectoryDefault)
+
+	case "sql":
+		user := viper.GetString("DB_USER")
+		password := viper.GetString("DB_PASSWORD")
+		if user == "" || password == "" {
+			return "", "", errors.New("AUTH_MODE sql requires DB_USER and DB_PASSWORD")
+		}
+		connURL.User = url.UserPassword(user, password)
+		connURL.RawQuery = query.Encode()
+		return "sqlserver", connURL.String(), nil
+
+	case "managed_identity":
+		query.Set("fedauth", azuread.ActiveDirectoryManagedIdentity)
+		// A client id selects a user-assigned identity, otherwise the
+		// system-assigned identity is used.
+		if clientID := viper.GetString("AZURE_CLIENT_ID"); clientID != "" {
+			connURL.User = url.User(clientID)
+		}
+
+	case "service_principal":
+		clientID := viper.GetString("AZURE_CLIENT_ID")
+		tenantID := viper.GetString("AZURE_TENANT_ID")
+		if clientID == "" || tenantID == "" {
+			return "", "", errors.New("AUTH_MODE service_principal requires AZURE_CLIENT_ID and AZURE_TENANT_ID")
+		}
+		query.Set("fedauth", azuread.ActiveDirectoryServicePrincipal)
+
+		secret := viper.GetString("AZURE_CLIENT_SECRET")
+		certPath := viper.GetString("AZURE_CLIENT_CERTIFICATE_PATH")
+		switch {
+		case certPath != "":
+			query.Set("clientcertpath", certPath)
+			connURL.User = url.UserPassword(clientID+"@"+tenantID, viper.GetString("AZURE_CLIENT_CERTIFICATE_PASSWORD"))
+		case secret != "":
+			connURL.User = url.UserPassword(clientID+"@"+tenantID, secret)
+		default:
+			return "", "", errors.New("AUTH_MODE service_principal requires AZURE_CLIENT_SECRET or AZURE_CLIENT_CERTIFICATE_PATH")
+		}
+
+	default:
+		return "", "", fmt.Errorf("unsupported AUTH_MODE %q, expected one of default, sql, connection_string, managed_identity, service_principal", authMode)
+	}
+
+	connURL.RawQuery = query.Encode()
+	return azuread.DriverName, connURL.String(), nil
+}
+
+func (sqlServerDialect) DefaultSchema(db *gorm.DB) (string, error) {
+	var schema string
+	err := db.Raw("SELECT SCHEMA_NAME()").Scan(&schema).Error
+	return schema, err
+}
+
+func (sqlServerDialect) Tables(db *gorm.DB) ([]TableInfo, error) {
+	query := `
+	SELECT
+		TABLE_SCHEMA AS [Schema],
+		TABLE_NAME AS Name,
+		CASE WHEN TABLE_TYPE = 'VIEW' THEN 'view' ELSE 'table' END AS Type
+	FROM INFORMATION_SCHEMA.TABLES
+	WHERE TABLE_TYPE IN ('BASE TABLE', 'VIEW')
+	ORDER BY TABLE_SCHEMA, TABLE_NAME;
+	`
+
+	var tables []TableInfo
+	err := db.Raw(query).Scan(&tables).Error
+	return tables, err
+}
+
+func (sqlServerDialect) Columns(db *gorm.DB, table TableRef) ([]SchemaColumn, error) {
+	query := `
+		SELECT
+    		c.COLUMN_NAME AS DbName,
+    		c.DATA_TYPE AS DbType,
+    		CASE WHEN c.IS_NULLABLE = 'YES' THEN 1 ELSE 0 END AS Nullable,
+    		c.ORDINAL_POSITION AS Ordinal,
+    		c.CHARACTER_MAXIMUM_LENGTH AS MaxLength,
+    		COALESCE(c.NUMERIC_PRECISION, c.DATETIME_PRECISION) AS Precision,
+    		c.NUMERIC_SCALE AS Scale,
+    		c.COLUMN_DEFAULT AS [Default],
+    		sc.is_identity AS [Identity],
+    		sc.is_computed AS Computed,
+    		CASE WHEN c.DATA_TYPE IN ('timestamp', 'rowversion') THEN 1 ELSE 0 END AS RowVersion,
+    		MAX(CASE WHEN tc.CONSTRAINT_TYPE = 'PRIMARY KEY' THEN 1 ELSE 0 END) AS "Key",
+    		MAX(CASE WHEN tc.CONSTRAINT_TYPE = 'FOREIGN KEY' THEN k.CONSTRAINT_NAME END) AS ForeignKey
+		FROM INFORMATION_SCHEMA.COLUMNS c
+		JOIN sys.columns sc
+    		ON sc.object_id = OBJECT_ID(QUOTENAME(c.TABLE_SCHEMA) + '.' + QUOTENAME(c.TABLE_NAME))
+    		AND sc.name = c.COLUMN_NAME
+		LEFT JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE k
+    		ON c.TABLE_NAME = k.TABLE_NAME
+    		AND c.COLUMN_NAME = k.COLUMN_NAME
+    		AND c.TABLE_SCHEMA = k.TABLE_SCHEMA
+		LEFT JOIN INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc
+    		ON k.TABLE_NAME = tc.TABLE_NAME
+    		AND k.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+    		AND k.TABLE_SCHEMA = tc.TABLE_SCHEMA
+    		AND tc.CONSTRAINT_TYPE IN ('PRIMARY KEY', 'FOREIGN KEY')
+		WHERE c.TABLE_SCHEMA = ? AND c.TABLE_NAME = ?
+		GROUP BY c.COLUMN_NAME, c.DATA_TYPE, c.IS_NULLABLE, c.ORDINAL_POSITION, c.CHARACTER_MAXIMUM_LENGTH,
+    		c.NUMERIC_PRECISION, c.DATETIME_PRECISION, c.NUMERIC_SCALE, c.COLUMN_DEFAULT, sc.is_identity, sc.is_computed
+		ORDER BY c.ORDINAL_POSITION;
+	`
+
+	var columns []SchemaColumn
+	err := db.Raw(query, table.Schema, table.Name).Scan(&columns).Error
+	return columns, err
+}
+
+func (sqlServerDialect) ForeignKey(db *gorm.DB, schema string, foreignKeyName string) (FkMapping, error) {
+	query := `
+	SELECT
+    	fk.CONSTRAINT_NAME AS FOREIGN_KEY_NAME,
+    	fk.TABLE_NAME AS FOREIGN_TABLE,
+    	fk.COLUMN_NAME AS FOREIGN_COLUMN,
+    	pk.TABLE_SCHEMA AS REFERENCED_SCHEMA,
+    	pk.TABLE_NAME AS REFERENCED_TABLE,
+    	pk.COLUMN_NAME AS REFERENCED_COLUMN
+	FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE fk
+	JOIN INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS rc
+    	ON fk.CONSTRAINT_NAME = rc.CONSTRAINT_NAME
+    	AND fk.CONSTRAINT_SCHEMA = rc.CONSTRAINT_SCHEMA
+	JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE pk
+    	ON pk.CONSTRAINT_NAME = rc.UNIQUE_CONSTRAINT_NAME
+    	AND pk.CONSTRAINT_SCHEMA = rc.UNIQUE_CONSTRAINT_SCHEMA
+    	AND pk.ORDINAL_POSITION = fk.ORDINAL_POSITION
+	WHERE fk.CONSTRAINT_SCHEMA = ? AND fk.CONSTRAINT_NAME = ?;
+	`
+
+	return scanForeignKey(db, query, schema, foreignKeyName)
+}
+
+func (sqlServerDialect) MapType(dbType string) (string, string) {
+	switch baseType(dbType) {
+	case "int", "bigint", "smallint", "tinyint":
+		return "int", "number"
+	case "decimal", "numeric", "money", "smallmoney":
+		return "decimal", "number"
+	case "float", "real":
+		return "float", "number"
+	case "bit":
+		return "bool", "boolean"
+	case "date":
+		return "date", "date"
+	case "datetime", "datetime2", "smalldatetime", "datetimeoffset":
+		return "datetime", "datetime"
+	case "time":
+		return "time", "text"
+	case "uniqueidentifier":
+		return "guid", "text"
+	case "binary", "varbinary", "image", "rowversion", "timestamp":
+		return "binary", "text"
+	case "char", "varchar", "text", "nchar", "nvarchar", "ntext", "xml", "sysname":
+		return "string", "text"
+	}
+
+	return "interface{}", dbType
+}
+
+// Regexp is unsupported, since SQL Server has no regular expression
+// predicate before REGEXP_LIKE in SQL Server 2025.
+func (sqlServerDialect) Regexp(column string) (string, bool) {
+	return "", false
+}
+
+func (sqlServerDialect) NullsFirst() bool {
+	return true
+}
+
+func (sqlServerDialect) RowLock() (string, string) {
+	return " WITH (UPDLOCK, ROWLOCK)", ""
+}
+
+// Insert captures the key of the new row with OUTPUT ... INTO, which unlike
+// a bare OUTPUT clause is allowed on tables with triggers, and reads the row
+// back by that key so that values set by triggers are returned as well.
+// Tables without a primary key return the inserted values themselves.
+func (sqlServerDialect) Insert(tx *gorm.DB, table TableRef, columns []SchemaColumn, values map[string]interface{}, returning []string, dest interface{}) error {
+	columnList, valuesClause, vars := insertClauses(tx, values)
+
+	query := "INSERT INTO " + quoteTable(tx, table) + " " + columnList
+	if len(returning) == 0 {
+		return tx.Exec(query+" "+valuesClause, vars...).Error
+	}
+
+	var captured []SchemaColumn
+	for _, col := range columns {
+		if col.Key {
+			captured = append(captured, col)
+		}
+	}
+	keyed := len(captured) > 0
+	if !keyed {
+		for _, col := range columns {
+			if containsString(returning, col.DbName) {
+				captured = append(captured, col)
+			}
+		}
+	}
+
+	declarations := make([]string, len(captured))
+	names := make([]string, len(captured))
+	for i, col := range captured {
+		declarations[i] = quoteColumn(tx, col.DbName) + " " + sqlServerColumnType(col)
+		names[i] = col.DbName
+	}
+
+	batch := "DECLARE @inserted TABLE (" + strings.Join(declarations, ", ") + "); " +
+		query + " OUTPUT " + quoteColumns(tx, names, "INSERTED.") + " INTO @inserted " + valuesClause + "; "
+	if keyed {
+		joins := make([]string, len(names))
+		for i, name := range names {
+			joins[i] = "t." + quoteColumn(tx, name) + " = i." + quoteColumn(tx, name)
+		}
+		batch += "SELECT " + quoteColumns(tx, returning, "t.") + " FROM " + quoteTable(tx, table) +
+			" AS t JOIN @inserted AS i ON " + strings.Join(joins, " AND ")
+	} else {
+		batch += "SELECT " + quoteColumns(tx, returning, "") + " FROM @inserted"
+	}
+	return tx.Raw(batch, vars...).Scan(dest).Error
+}
+
+// sqlServerColumnType renders the type of a column for a table variable.
+// rowversion values are held as binary(8), since a rowversion column cannot
+// be assigned.
+func sqlServerColumnType(col SchemaColumn) string {
+	dbType := baseType(col.DbType)
+	switch dbType {
+	case "timestamp", "rowversion":
+		return "binary(8)"
+	case "char", "varchar", "nchar", "nvarchar", "binary", "varbinary":
+		if col.MaxLength == nil {
+			return dbType
+		}
+		if *col.MaxLength < 0 {
+			return dbType + "(max)"
+		}
+		return fmt.Sprintf("%s(%d)", dbType, *col.MaxLength)
+	case "decimal", "numeric":
+		if col.Precision == nil || col.Scale == nil {
+			return dbType
+		}
+		return fmt.Sprintf("%s(%d, %d)", dbType, *col.Precision, *col.Scale)
+	case "datetime2", "datetimeoffset", "time":
+		if col.Precision == nil {
+			return dbType
+		}
+		return fmt.Sprintf("%s(%d)", dbType, *col.Precision)
+	}
+	return dbType
+}
+
+// Update reads the row back after updating it rather than using an OUTPUT
+// clause, which fails on tables with triggers and would miss the values they
+// set. The key columns in where are assumed unchanged by values, and rows
+// are counted by the read, since triggers may change the reported count.
+func (sqlServerDialect) Update(tx *gorm.DB, table TableRef, values map[string]interface{}, where map[string]interface{}, returning []string, dest interface{}) (int64, error) {
+	if len(values) > 0 {
+		assignments, vars := setClause(tx, values)
+		condition, whereVars, err := whereClause(tx, where)
+		if err != nil {
+			return 0, err
+		}
+
+		err = tx.Exec("UPDATE "+quoteTable(tx, table)+" SET "+assignments+" WHERE "+condition, append(vars, whereVars...)...).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if len(returning) == 0 {
+		var count int64
+		condition, vars, err := whereClause(tx, where)
+		if err != nil {
+			return 0, err
+		}
+		err = tx.Raw("SELECT COUNT(*) FROM "+quoteTable(tx, table)+" WHERE "+condition, vars...).Scan(&count).Error
+		return count, err
+	}
+	return selectRow(tx, table, where, returning, dest)
+}
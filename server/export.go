@@ -0,0 +1,360 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// ExportRequest is a QueryRequest without paging, plus the output format and
+// the columns to export, in order. All columns are exported if none are
+// given.
+type ExportRequest struct {
+	QueryRequest
+	Format  string   `json:"format"`
+	Columns []string `json:"columns"`
+}
+
+// exportWriter writes one export format. Rows are written as they are read
+// from the database, so the result set is never held in memory.
+type exportWriter interface {
+	WriteHeader(columns []SchemaColumn) error
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+type exportFormat struct {
+	ContentType string
+	Extension   string
+	New         func(w io.Writer) (exportWriter, error)
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv":    {"text/csv; charset=utf-8", "csv", newCSVExport},
+	"ndjson": {"application/x-ndjson", "ndjson", newNDJSONExport},
+	"xlsx":   {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx", newXLSXExport},
+}
+
+// exportFlushRows is how often the streamed response is flushed.
+const exportFlushRows = 1000
+
+func exportData(c *gin.Context) {
+	table := tableParam(c)
+
+	var req ExportRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Format == "" {
+		req.Format = c.DefaultQuery("format", "csv")
+	}
+	format, ok := exportFormats[strings.ToLower(req.Format)]
+	if !ok {
+		names := make([]string, 0, len(exportFormats))
+		for name := range exportFormats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		c.JSON(400, gin.H{"error": "Invalid export format: " + req.Format + ". Valid formats are: " + strings.Join(names, ", ")})
+		return
+	}
+
+	columns, err := getSchemaColumns(table)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	restrictions, err := restrictColumns(currentUser(c), table)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := rowFilter(currentUser(c), table)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	selected, err := exportColumns(restrictions.visible(columns), req.Columns)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	condition, err := compileFilter(table, req.filterTree())
+	if err == nil {
+		err = restrictions.checkQuery(req.filterTree(), req.Sort)
+	}
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	ordering, err := resolveOrdering(table, req.Sort, restrictions)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	stmt := tableStatement(db, table).Select(quoteColumns(db, columnNames(selected), "")).Where(filter).Where(condition)
+	rows, err := applyOrdering(stmt, ordering).Rows()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", format.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, table.String(), format.Extension))
+	c.Status(200)
+
+	writer, err := format.New(c.Writer)
+	if err == nil {
+		err = writer.WriteHeader(selected)
+	}
+
+	genStructType := getStructSchema(table)
+	row := reflect.New(genStructType)
+	count := 0
+	for err == nil && rows.Next() {
+		row.Elem().Set(reflect.Zero(genStructType))
+		if err = db.ScanRows(rows, row.Interface()); err != nil {
+			break
+		}
+
+		data := convertGormStructToMap(row.Interface())
+		values := make([]interface{}, len(selected))
+		for i, col := range selected {
+			values[i] = restrictions.value(col.DbName, data[col.DbName])
+		}
+		err = writer.WriteRow(values)
+
+		if count++; count%exportFlushRows == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if writer != nil {
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	// The status is already sent, so a failure can only cut the download
+	// short.
+	if err != nil {
+		log.Println("Error exporting", table.String()+":", err)
+	}
+}
+
+// exportColumns resolves the requested column names against the schema.
+func exportColumns(columns []SchemaColumn, names []string) ([]SchemaColumn, error) {
+	if len(names) == 0 {
+		return columns, nil
+	}
+
+	byName := make(map[string]SchemaColumn)
+	for _, col := range columns {
+		byName[col.DbName] = col
+	}
+
+	selected := make([]SchemaColumn, 0, len(names))
+	for _, name := range names {
+		col, ok := byName[name]
+		if !ok {
+			return nil, errors.New("Invalid column name in export: " + name)
+		}
+		selected = append(selected, col)
+	}
+	return selected, nil
+}
+
+// exportText renders a value as text, in the same format as its JSON form.
+func exportText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case Date:
+		return time.Time(v).Format(dateFormat)
+	case DateTime:
+		return time.Time(v).Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+type csvExport struct {
+	writer *csv.Writer
+	record []string
+}
+
+func newCSVExport(w io.Writer) (exportWriter, error) {
+	return &csvExport{writer: csv.NewWriter(w)}, nil
+}
+
+func (e *csvExport) WriteHeader(columns []SchemaColumn) error {
+	return e.writer.Write(columnNames(columns))
+}
+
+func (e *csvExport) WriteRow(values []interface{}) error {
+	e.record = e.record[:0]
+	for _, value := range values {
+		e.record = append(e.record, exportText(value))
+	}
+	return e.writer.Write(e.record)
+}
+
+func (e *csvExport) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// ndjsonExport writes one JSON object per line, with keys in column order.
+type ndjsonExport struct {
+	writer *bufio.Writer
+	keys   [][]byte
+}
+
+func newNDJSONExport(w io.Writer) (exportWriter, error) {
+	return &ndjsonExport{writer: bufio.NewWriter(w)}, nil
+}
+
+func (e *ndjsonExport) WriteHeader(columns []SchemaColumn) error {
+	for _, col := range columns {
+		key, err := json.Marshal(col.DbName)
+		if err != nil {
+			return err
+		}
+		e.keys = append(e.keys, append(key, ':'))
+	}
+	return nil
+}
+
+func (e *ndjsonExport) WriteRow(values []interface{}) error {
+	e.writer.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			e.writer.WriteByte(',')
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		e.writer.Write(e.keys[i])
+		e.writer.Write(encoded)
+	}
+	_, err := e.writer.WriteString("}\n")
+	return err
+}
+
+func (e *ndjsonExport) Close() error {
+	return e.writer.Flush()
+}
+
+// xlsxExport writes a single worksheet through excelize's stream writer,
+// which spills rows to a temporary file instead of keeping them in memory.
+// The workbook is sent when it is closed, zipped straight into the response
+// rather than into the in-memory buffer excelize would otherwise build.
+type xlsxExport struct {
+	file          *excelize.File
+	stream        *excelize.StreamWriter
+	row           int
+	dateStyle     int
+	dateTimeStyle int
+}
+
+func newXLSXExport(w io.Writer) (exportWriter, error) {
+	file := excelize.NewFile()
+	file.SetZipWriter(func(io.Writer) excelize.ZipWriter { return zip.NewWriter(w) })
+	stream, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		return nil, err
+	}
+
+	e := &xlsxExport{file: file, stream: stream, row: 1}
+	if e.dateStyle, err = file.NewStyle(&excelize.Style{NumFmt: 14}); err != nil {
+		return nil, err
+	}
+	if e.dateTimeStyle, err = file.NewStyle(&excelize.Style{NumFmt: 22}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *xlsxExport) WriteHeader(columns []SchemaColumn) error {
+	style, err := e.file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	cells := make([]interface{}, len(columns))
+	for i, col := range columns {
+		cells[i] = excelize.Cell{StyleID: style, Value: col.DbName}
+	}
+	return e.writeRow(cells)
+}
+
+func (e *xlsxExport) WriteRow(values []interface{}) error {
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil, int64, float64, bool:
+			cells[i] = v
+		case Decimal:
+			if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+				cells[i] = f
+			} else {
+				cells[i] = string(v)
+			}
+		case Date:
+			cells[i] = excelize.Cell{StyleID: e.dateStyle, Value: time.Time(v)}
+		case DateTime:
+			cells[i] = excelize.Cell{StyleID: e.dateTimeStyle, Value: time.Time(v)}
+		default:
+			cells[i] = exportText(v)
+		}
+	}
+	return e.writeRow(cells)
+}
+
+func (e *xlsxExport) writeRow(cells []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, e.row)
+	if err != nil {
+		return err
+	}
+	e.row++
+	return e.stream.SetRow(cell, cells)
+}
+
+func (e *xlsxExport) Close() error {
+	defer e.file.Close()
+	if err := e.stream.Flush(); err != nil {
+		return err
+	}
+	// The workbook is zipped into the response by the writer set in
+	// newXLSXExport, so the buffer excelize writes to stays empty.
+	return e.file.Write(io.Discard)
+}
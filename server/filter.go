@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+const maxFilterDepth = 32
+
+// FilterNode is a boolean filter expression. A group combines its children
+// with Operator AND, OR or NOT (which negates the AND of its children); a
+// leaf compares Field using the filter Type.
+//
+// Conditions is the AG Grid form of a group: its entries inherit Field from
+// the node, so {"field": "a", "operator": "OR", "conditions": [...]} combines
+// several conditions on column a.
+type FilterNode struct {
+	Operator   string       `json:"operator"`
+	Children   []FilterNode `json:"children"`
+	Conditions []FilterNode `json:"conditions"`
+
+	Field    string      `json:"field"`
+	Type     string      `json:"type"`
+	Filter   interface{} `json:"filter"`
+	FilterTo interface{} `json:"filterTo"`
+}
+
+func (n FilterNode) isGroup() bool {
+	return n.Operator != "" || len(n.Children) > 0 || len(n.Conditions) > 0
+}
+
+// compileFilter turns the expression into a parenthesised, parameterised
+// condition, validating every column against the table schema.
+func compileFilter(table TableRef, node FilterNode) (clause.Expr, error) {
+	sql, vars, err := compileFilterNode(table, node, 0)
+	if err != nil {
+		return clause.Expr{}, err
+	}
+	return clause.Expr{SQL: sql, Vars: vars}, nil
+}
+
+func compileFilterNode(table TableRef, node FilterNode, depth int) (string, []interface{}, error) {
+	if depth > maxFilterDepth {
+		return "", nil, fmt.Errorf("filter is nested deeper than %d levels", maxFilterDepth)
+	}
+
+	if !node.isGroup() {
+		column, ok := lookupColumn(table, node.Field)
+		if !ok {
+			return "", nil, errors.New("Invalid column name in filter: " + node.Field)
+		}
+		return generateFilterStatement(column, node.Type, node.Filter, node.FilterTo)
+	}
+
+	children := append([]FilterNode{}, node.Children...)
+	for _, condition := range node.Conditions {
+		if condition.Field == "" {
+			condition.Field = node.Field
+		}
+		children = append(children, condition)
+	}
+
+	var parts []string
+	var vars []interface{}
+	for _, child := range children {
+		sql, childVars, err := compileFilterNode(table, child, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, sql)
+		vars = append(vars, childVars...)
+	}
+
+	switch strings.ToUpper(node.Operator) {
+	case "", "AND":
+		if len(parts) == 0 {
+			return "1 = 1", nil, nil
+		}
+		return "(" + strings.Join(parts, " AND ") + ")", vars, nil
+	case "OR":
+		if len(parts) == 0 {
+			return "1 = 0", nil, nil
+		}
+		return "(" + strings.Join(parts, " OR ") + ")", vars, nil
+	case "NOT":
+		if len(parts) == 0 {
+			return "", nil, errors.New("NOT filter requires at least one child")
+		}
+		return "(NOT (" + strings.Join(parts, " AND ") + "))", vars, nil
+	}
+
+	return "", nil, errors.New("Invalid filter operator: " + node.Operator)
+}
+
+// filterOperator renders the condition for one filter type on the quoted
+// column field.
+type filterOperator func(field string, column SchemaColumn, value interface{}, endValue interface{}) (string, []interface{}, error)
+
+var filterOperators = map[string]filterOperator{
+	"equals":             compare("="),
+	"notEqual":           compare("!="),
+	"greaterThan":        compare(">"),
+	"lessThan":           compare("<"),
+	"greaterThanOrEqual": compare(">="),
+	"lessThanOrEqual":    compare("<="),
+	"inRange": func(field string, column SchemaColumn, value interface{}, endValue interface{}) (string, []interface{}, error) {
+		return field + " BETWEEN ? AND ?", []interface{}{value, endValue}, nil
+	},
+	"blank": func(field string, column SchemaColumn, value interface{}, endValue interface{}) (string, []interface{}, error) {
+		return field + " IS NULL", nil, nil
+	},
+	"notBlank": func(field string, column SchemaColumn, value interface{}, endValue interface{}) (string, []interface{}, error) {
+		return field + " IS NOT NULL", nil, nil
+	},
+
+	"contains":    like("%", "%", false),
+	"notContains": like("%", "%", true),
+	"startsWith":  like("", "%", false),
+	"endsWith":    like("%", "", false),
+
+	"equalsIgnoreCase":      ignoreCase(compare("=")),
+	"notEqualIgnoreCase":    ignoreCase(compare("!=")),
+	"containsIgnoreCase":    ignoreCase(like("%", "%", false)),
+	"notContainsIgnoreCase": ignoreCase(like("%", "%", true)),
+	"startsWithIgnoreCase":  ignoreCase(like("", "%", false)),
+	"endsWithIgnoreCase":    ignoreCase(like("%", "", false)),
+
+	"in":    inList(false),
+	"notIn": inList(true),
+
+	"today": relativeDate(func(today time.Time, value interface{}) (time.Time, time.Time, error) {
+		return today, today.AddDate(0, 0, 1), nil
+	}),
+	// lastNDays covers today and the N days before it.
+	"lastNDays": relativeDate(func(today time.Time, value interface{}) (time.Time, time.Time, error) {
+		days, err := strconv.Atoi(fmt.Sprint(value))
+		if err != nil || days < 0 {
+			return time.Time{}, time.Time{}, errors.New("lastNDays expects a non-negative number of days")
+		}
+		return today.AddDate(0, 0, -days), today.AddDate(0, 0, 1), nil
+	}),
+	"thisMonth": relativeDate(func(today time.Time, value interface{}) (time.Time, time.Time, error) {
+		start := today.AddDate(0, 0, 1-today.Day())
+		return start, start.AddDate(0, 1, 0), nil
+	}),
+
+	// like takes a raw LIKE pattern with % and _ wildcards.
+	"like": func(field string, column SchemaColumn, value interface{}, endValue interface{}) (string, []interface{}, error) {
+		return field + " LIKE ?", []interface{}{fmt.Sprint(value)}, nil
+	},
+	"regex": func(field string, column SchemaColumn, value interface{}, endValue interface{}) (string, []interface{}, error) {
+		condition, ok := dialect.Regexp(field)
+		if !ok {
+			return "", nil, errors.New("Filter type regex is not supported by " + dialect.Name())
+		}
+		return condition, []interface{}{fmt.Sprint(value)}, nil
+	},
+}
+
+func filterTypeNames() []string {
+	names := make([]string, 0, len(filterOperators))
+	for name := range filterOperators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func generateFilterStatement(column SchemaColumn, filterType string, value interface{}, endValue interface{}) (string, []interface{}, error) {
+	operator, ok := filterOperators[filterType]
+	if !ok {
+		return "", nil, fmt.Errorf("Invalid filter type: %s. Valid types are: %s", filterType, strings.Join(filterTypeNames(), ", "))
+	}
+
+	return operator(quoteColumn(db, column.DbName), column, value, endValue)
+}
+
+func compare(op string) filterOperator {
+	return func(field string, column SchemaColumn, value interface{}, endValue interface{}) (string, []interface{}, error) {
+		return field + " " + op + " ?", []interface{}{value}, nil
+	}
+}
+
+// likeEscaper escapes the LIKE wildcards of every supported database,
+// including SQL Server's [ character classes, with ! as escape character.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_", "[", "![")
+
+func like(prefix string, suffix string, negate bool) filterOperator {
+	return func(field string, column SchemaColumn, value interface{}, endValue interface{}) (string, []interface{}, error) {
+		op := " LIKE "
+		if negate {
+			op = " NOT LIKE "
+		}
+		pattern := prefix + likeEscaper.Replace(fmt.Sprint(value)) + suffix
+		return field + op + "? ESCAPE '!'", []interface{}{pattern}, nil
+	}
+}
+
+// ignoreCase compares the lower-cased column with the lower-cased value.
+func ignoreCase(operator filterOperator) filterOperator {
+	return func(field string, column SchemaColumn, value interface{}, endValue interface{}) (string, []interface{}, error) {
+		return operator("LOWER("+field+")", column, strings.ToLower(fmt.Sprint(value)), endValue)
+	}
+}
+
+func inList(negate bool) filterOperator {
+	return func(field string, column SchemaColumn, value interface{}, endValue interface{}) (string, []interface{}, error) {
+		values, ok := value.([]interface{})
+		if !ok {
+			return "", nil, errors.New("Filter types in and notIn expect a list of values")
+		}
+
+		if len(values) == 0 {
+			if negate {
+				return "1 = 1", nil, nil
+			}
+			return "1 = 0", nil, nil
+		}
+
+		if negate {
+			return field + " NOT IN ?", []interface{}{values}, nil
+		}
+		return field + " IN ?", []interface{}{values}, nil
+	}
+}
+
+// relativeDate filters a date or datetime column on the half-open range
+// [from, to) computed from the server's current day.
+func relativeDate(dateRange func(today time.Time, value interface{}) (time.Time, time.Time, error)) filterOperator {
+	return func(field string, column SchemaColumn, value interface{}, endValue interface{}) (string, []interface{}, error) {
+		if column.GoType != "date" && column.GoType != "datetime" {
+			return "", nil, errors.New("Relative date filters require a date column: " + column.DbName)
+		}
+
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		from, to, err := dateRange(today, value)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return "(" + field + " >= ? AND " + field + " < ?)", []interface{}{dateValue(column, from), dateValue(column, to)}, nil
+	}
+}
+
+func dateValue(column SchemaColumn, t time.Time) interface{} {
+	if column.GoType == "date" {
+		return Date(t)
+	}
+	return DateTime(t)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const peopleSchema = `
+CREATE TABLE people (id INTEGER PRIMARY KEY, name VARCHAR(50) NOT NULL, age INTEGER, born DATE, note TEXT);
+INSERT INTO people VALUES (1, 'Ada', 36, '1815-12-10', '100% sure');
+INSERT INTO people VALUES (2, 'alan', 41, '1912-06-23', NULL);
+INSERT INTO people VALUES (3, 'Grace', 85, '1906-12-09', 'a_b');
+INSERT INTO people VALUES (4, 'Linus', NULL, NULL, 'kernel')`
+
+var people = TableRef{Schema: "main", Name: "people"}
+
+// filterIDs returns the ids of the people matching a filter.
+func filterIDs(t *testing.T, node FilterNode) ([]int64, error) {
+	t.Helper()
+
+	condition, err := compileFilter(people, node)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int64{}
+	err = tableStatement(db, people).Where(condition).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func TestCompileFilter(t *testing.T) {
+	openTestDB(t, peopleSchema)
+	today := time.Now().Format(dateFormat)
+	db.Exec(`INSERT INTO people VALUES (5, 'Today', 1, ?, NULL)`, today)
+
+	leaf := func(field string, filterType string, value interface{}) FilterNode {
+		return FilterNode{Field: field, Type: filterType, Filter: value}
+	}
+
+	tests := []struct {
+		name string
+		node FilterNode
+		want []int64
+	}{
+		{"empty and", FilterNode{Operator: "AND"}, []int64{1, 2, 3, 4, 5}},
+		{"equals", leaf("name", "equals", "Ada"), []int64{1}},
+		{"notEqual", leaf("age", "notEqual", 36), []int64{2, 3, 5}},
+		{"greaterThan", leaf("age", "greaterThan", 40), []int64{2, 3}},
+		{"inRange", FilterNode{Field: "age", Type: "inRange", Filter: 36, FilterTo: 41}, []int64{1, 2}},
+		{"blank", leaf("age", "blank", nil), []int64{4}},
+		{"notBlank", leaf("note", "notBlank", nil), []int64{1, 3, 4}},
+		{"contains escapes %", leaf("note", "contains", "0%"), []int64{1}},
+		{"contains escapes _", leaf("note", "contains", "_"), []int64{3}},
+		{"startsWith", leaf("name", "startsWith", "Gr"), []int64{3}},
+		{"endsWith", leaf("name", "endsWith", "us"), []int64{4}},
+		{"notContains", leaf("name", "notContains", "l"), []int64{1, 3, 5}},
+		{"equalsIgnoreCase", leaf("name", "equalsIgnoreCase", "ALAN"), []int64{2}},
+		{"startsWithIgnoreCase", leaf("name", "startsWithIgnoreCase", "a"), []int64{1, 2}},
+		{"in", leaf("id", "in", []interface{}{1, 3}), []int64{1, 3}},
+		{"empty in", leaf("id", "in", []interface{}{}), []int64{}},
+		{"notIn", leaf("id", "notIn", []interface{}{1, 3}), []int64{2, 4, 5}},
+		{"empty notIn", leaf("id", "notIn", []interface{}{}), []int64{1, 2, 3, 4, 5}},
+		{"like", leaf("name", "like", "_r%"), []int64{3}},
+		{"regex", leaf("name", "regex", "^[AL]"), []int64{1, 4}},
+		{"today", leaf("born", "today", nil), []int64{5}},
+		{"lastNDays", leaf("born", "lastNDays", 3), []int64{5}},
+		{"or", FilterNode{Operator: "OR", Children: []FilterNode{
+			leaf("name", "equals", "Ada"),
+			leaf("name", "equals", "Grace"),
+		}}, []int64{1, 3}},
+		{"not", FilterNode{Operator: "NOT", Children: []FilterNode{
+			leaf("age", "greaterThan", 40),
+		}}, []int64{1, 5}},
+		{"nested", FilterNode{Operator: "AND", Children: []FilterNode{
+			leaf("age", "notBlank", nil),
+			{Operator: "OR", Children: []FilterNode{
+				leaf("name", "startsWith", "Ad"),
+				leaf("age", "lessThan", 10),
+			}},
+		}}, []int64{1, 5}},
+		{"conditions inherit field", FilterNode{Field: "age", Operator: "OR", Conditions: []FilterNode{
+			{Type: "equals", Filter: 36},
+			{Type: "equals", Filter: 85},
+		}}, []int64{1, 3}},
+		{"empty or", FilterNode{Operator: "OR"}, []int64{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ids, err := filterIDs(t, test.node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("got %v, want %v", ids, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	openTestDB(t, peopleSchema)
+
+	deep := FilterNode{Field: "id", Type: "equals", Filter: 1}
+	for i := 0; i <= maxFilterDepth; i++ {
+		deep = FilterNode{Operator: "AND", Children: []FilterNode{deep}}
+	}
+
+	tests := []struct {
+		name string
+		node FilterNode
+		want string
+	}{
+		{"unknown column", FilterNode{Field: "salary", Type: "equals", Filter: 1}, "Invalid column name"},
+		{"injected column", FilterNode{Field: "id = 1 OR 1", Type: "equals", Filter: 1}, "Invalid column name"},
+		{"unknown type", FilterNode{Field: "id", Type: "near", Filter: 1}, "Invalid filter type"},
+		{"unknown operator", FilterNode{Operator: "XOR", Children: []FilterNode{{Field: "id", Type: "blank"}}}, "Invalid filter operator"},
+		{"empty not", FilterNode{Operator: "NOT"}, "requires at least one child"},
+		{"in without list", FilterNode{Field: "id", Type: "in", Filter: 1}, "expect a list"},
+		{"relative date on text", FilterNode{Field: "name", Type: "today"}, "require a date column"},
+		{"too deep", deep, "nested deeper"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := filterIDs(t, test.node)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime/multipart"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImportReport is the result of an import or a dry run. Rows are numbered
+// as in the file, where row 1 is the header.
+type ImportReport struct {
+	DryRun         bool          `json:"dryRun"`
+	Rows           int           `json:"rows"`
+	Valid          int           `json:"valid"`
+	Inserted       int           `json:"inserted"`
+	IgnoredColumns []string      `json:"ignoredColumns"`
+	Errors         []ImportError `json:"errors"`
+	Error          string        `json:"error,omitempty"`
+}
+
+type ImportError struct {
+	Row    int    `json:"row"`
+	Column string `json:"column,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Error  string `json:"error"`
+}
+
+type importRow struct {
+	line   int
+	values map[string]interface{}
+}
+
+// importBatchSize is the default number of rows committed per transaction.
+const importBatchSize = 500
+
+var guidPattern = regexp.MustCompile(`^[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}$`)
+
+// importData loads a CSV or XLSX file into the table. Every row is validated
+// first; only a file without errors is inserted, in transactions of
+// batchSize rows. With dryRun=true the report is returned without writing.
+func importData(c *gin.Context) {
+	table := tableParam(c)
+	if !ensureWritable(c, table) {
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid dryRun parameter"})
+		return
+	}
+
+	batchSize, err := strconv.Atoi(c.DefaultQuery("batchSize", strconv.Itoa(importBatchSize)))
+	if err != nil || batchSize <= 0 {
+		c.JSON(400, gin.H{"error": "Invalid batchSize parameter"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Missing file"})
+		return
+	}
+
+	records, err := readImportFile(fileHeader, c.Query("format"), c.Query("sheet"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if len(records) == 0 {
+		c.JSON(400, gin.H{"error": "The file has no header row"})
+		return
+	}
+
+	columns, err := getSchemaColumns(table)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := ImportReport{DryRun: dryRun, IgnoredColumns: []string{}, Errors: []ImportError{}}
+
+	restrictions, err := restrictColumns(currentUser(c), table)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Imported rows are inserted without reading them back, so they cannot
+	// be checked against a row filter.
+	if filter, err := rowFilter(currentUser(c), table); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	} else if filter.SQL != unfiltered {
+		c.JSON(403, gin.H{"error": "Permission denied: import into " + table.String() + " is not available with a row filter"})
+		return
+	}
+
+	mapped, err := mapImportHeaders(columns, restrictions, records[0], &report)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rows []importRow
+	for i, record := range records[1:] {
+		if isBlankRecord(record) {
+			continue
+		}
+		line := i + 2
+		report.Rows++
+
+		values := make(map[string]interface{})
+		for index, col := range mapped {
+			if col == nil {
+				continue
+			}
+
+			text := ""
+			if index < len(record) {
+				text = record[index]
+			}
+
+			value, err := parseImportValue(*col, text)
+			if err != nil {
+				report.Errors = append(report.Errors, ImportError{Row: line, Column: col.DbName, Value: text, Error: err.Error()})
+				continue
+			}
+			values[col.DbName] = value
+		}
+		rows = append(rows, importRow{line: line, values: values})
+	}
+
+	if err := checkImportForeignKeys(currentUser(c), columns, rows, &report); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	invalid := make(map[int]bool)
+	for _, e := range report.Errors {
+		invalid[e.Row] = true
+	}
+	report.Valid = report.Rows - len(invalid)
+	if invalid[1] {
+		report.Valid = 0
+	}
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Row < report.Errors[j].Row })
+
+	if dryRun {
+		c.JSON(200, report)
+		return
+	}
+	if len(report.Errors) > 0 {
+		c.JSON(422, report)
+		return
+	}
+
+	for start := 0; start < len(rows); start += batchSize {
+		batch := rows[start:min(start+batchSize, len(rows))]
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range batch {
+				if err := dialect.Insert(tx, table, columns, insertValues(columns, row.values), nil, nil); err != nil {
+					return fmt.Errorf("row %d: %w", row.line, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			report.Error = err.Error()
+			c.JSON(500, report)
+			return
+		}
+		report.Inserted += len(batch)
+	}
+
+	c.JSON(200, report)
+}
+
+// readImportFile reads all records of a CSV file or of one worksheet of an
+// XLSX file. The format defaults to the file extension.
+func readImportFile(fileHeader *multipart.FileHeader, format string, sheet string) ([][]string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(fileHeader.Filename), ".")
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(format) {
+	case "csv":
+		return readImportCSV(file)
+	case "xlsx":
+		return readImportXLSX(file, sheet)
+	}
+	return nil, errors.New("Invalid import format: " + format + ". Valid formats are: csv, xlsx")
+}
+
+func readImportCSV(file io.Reader) ([][]string, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 && len(records[0]) > 0 {
+		records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+	}
+	return records, nil
+}
+
+// readImportXLSX reads raw cell values, so numbers and dates are not
+// subject to the cell's display format.
+func readImportXLSX(file io.Reader, sheet string) ([][]string, error) {
+	workbook, err := excelize.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer workbook.Close()
+
+	if sheet == "" {
+		sheet = workbook.GetSheetName(0)
+	}
+
+	rows, err := workbook.Rows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records [][]string
+	for rows.Next() {
+		record, err := rows.Columns(excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Error()
+}
+
+func isBlankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// mapImportHeaders matches each header to a column by name, ignoring case
+// if there is no exact match. Unknown and generated columns, and columns the
+// caller may not write, are listed as ignored; required columns missing from
+// the file are reported on row 1.
+func mapImportHeaders(columns []SchemaColumn, restrictions columnRestrictions, headers []string, report *ImportReport) ([]*SchemaColumn, error) {
+	mapped := make([]*SchemaColumn, len(headers))
+	seen := make(map[string]bool)
+
+	for i, header := range headers {
+		header = strings.TrimSpace(header)
+
+		var match *SchemaColumn
+		for j := range columns {
+			if columns[j].DbName == header {
+				match = &columns[j]
+				break
+			}
+			if match == nil && strings.EqualFold(columns[j].DbName, header) {
+				match = &columns[j]
+			}
+		}
+
+		if match == nil || match.ReadOnly() || !restrictions.writable(match.DbName) {
+			if header != "" {
+				report.IgnoredColumns = append(report.IgnoredColumns, header)
+			}
+			continue
+		}
+		if seen[match.DbName] {
+			return nil, errors.New("Duplicate column in file: " + match.DbName)
+		}
+		seen[match.DbName] = true
+		mapped[i] = match
+	}
+
+	for _, col := range columns {
+		if !seen[col.DbName] && isImportRequired(col) {
+			report.Errors = append(report.Errors, ImportError{Row: 1, Column: col.DbName, Error: "required column is missing from the file"})
+		}
+	}
+
+	return mapped, nil
+}
+
+// isImportRequired reports whether a row must supply a value for the column.
+func isImportRequired(col SchemaColumn) bool {
+	return !col.Nullable && col.Default == nil && !col.ReadOnly()
+}
+
+// parseImportValue converts a cell to the column's Go type and checks it
+// against the column's length, precision and nullability.
+func parseImportValue(col SchemaColumn, text string) (interface{}, error) {
+	if col.GoType != "string" {
+		text = strings.TrimSpace(text)
+	}
+
+	if text == "" {
+		if isImportRequired(col) {
+			return nil, errors.New("value is required")
+		}
+		return nil, nil
+	}
+
+	switch col.GoType {
+	case "int":
+		value, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, errors.New("not an integer")
+		}
+		return value, nil
+	case "float":
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, errors.New("not a number")
+		}
+		return value, nil
+	case "decimal":
+		if !decimalPattern.MatchString(text) {
+			return nil, errors.New("not a decimal number")
+		}
+		return Decimal(text), checkDecimalPrecision(col, text)
+	case "bool":
+		switch strings.ToLower(text) {
+		case "yes", "y":
+			return true, nil
+		case "no", "n":
+			return false, nil
+		}
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, errors.New("not a boolean")
+		}
+		return value, nil
+	case "date":
+		t, err := parseImportTime(text, dateFormat)
+		return Date(t), err
+	case "datetime":
+		t, err := parseImportTime(text, time.RFC3339Nano)
+		return DateTime(t), err
+	case "time":
+		t, err := parseImportTime(text, timeOfDayFormat)
+		return TimeOfDay(t.Format(timeOfDayFormat)), err
+	case "guid":
+		if !guidPattern.MatchString(text) {
+			return nil, errors.New("not a GUID")
+		}
+		return GUID(strings.ToUpper(text)), nil
+	case "binary":
+		value, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, errors.New("not base64 encoded")
+		}
+		if col.MaxLength != nil && int64(len(value)) > *col.MaxLength {
+			return nil, fmt.Errorf("longer than %d bytes", *col.MaxLength)
+		}
+		return value, nil
+	case "string":
+		if col.MaxLength != nil && int64(utf8.RuneCountInString(text)) > *col.MaxLength {
+			return nil, fmt.Errorf("longer than %d characters", *col.MaxLength)
+		}
+		return text, nil
+	}
+
+	return text, nil
+}
+
+// parseImportTime accepts the usual text formats as well as the serial
+// numbers spreadsheets store dates and times as.
+func parseImportTime(text string, layout string) (time.Time, error) {
+	if serial, err := strconv.ParseFloat(text, 64); err == nil {
+		return excelize.ExcelDateToTime(serial, false)
+	}
+	return parseTime(text, layout)
+}
+
+func checkDecimalPrecision(col SchemaColumn, text string) error {
+	if col.Precision == nil || strings.ContainsAny(text, "eE") {
+		return nil
+	}
+
+	scale := int64(0)
+	if col.Scale != nil {
+		scale = *col.Scale
+	}
+
+	integer, fraction, _ := strings.Cut(strings.TrimLeft(text, "+-"), ".")
+	integer = strings.TrimLeft(integer, "0")
+	if int64(len(integer)) > *col.Precision-scale {
+		return fmt.Errorf("more than %d digits before the decimal point", *col.Precision-scale)
+	}
+	if int64(len(strings.TrimRight(fraction, "0"))) > scale {
+		return fmt.Errorf("more than %d decimal places", scale)
+	}
+	return nil
+}
+
+// checkImportForeignKeys reports values of foreign key columns that do not
+// exist in the referenced table. Only the rows and columns the user may read
+// are looked up, so that an import cannot probe for keys it may not see;
+// other references are left to the database's constraints.
+func checkImportForeignKeys(user *User, columns []SchemaColumn, rows []importRow, report *ImportReport) error {
+	const chunkSize = 500
+
+	for _, col := range columns {
+		if col.ForeignKey == "" {
+			continue
+		}
+		fk := cacheForeignKeys(col.ForeignKey)
+		if fk.ReferencedColumn == "" || !permitted(user, fk.ReferencedTable, permissionRead) {
+			continue
+		}
+		referenced, ok := lookupColumn(fk.ReferencedTable, fk.ReferencedColumn)
+		if !ok {
+			continue
+		}
+		restrictions, err := restrictColumns(user, fk.ReferencedTable)
+		if err != nil {
+			return err
+		}
+		if !restrictions.searchable(referenced.DbName) {
+			continue
+		}
+		filter, err := rowFilter(user, fk.ReferencedTable)
+		if err != nil {
+			return err
+		}
+
+		distinct := make(map[string]interface{})
+		for _, row := range rows {
+			if value := row.values[col.DbName]; value != nil {
+				distinct[importKey(value)] = value
+			}
+		}
+
+		values := make([]interface{}, 0, len(distinct))
+		for _, value := range distinct {
+			values = append(values, value)
+		}
+
+		// The existing values are read with the referenced column's type, so
+		// that they compare like the imported ones.
+		found := make(map[string]bool)
+		for start := 0; start < len(values); start += chunkSize {
+			existing := reflect.New(reflect.SliceOf(reflect.PointerTo(goTypes[referenced.GoType])))
+			err := tableStatement(db, fk.ReferencedTable).Where(filter).
+				Where(clause.IN{Column: clause.Column{Name: fk.ReferencedColumn}, Values: values[start:min(start+chunkSize, len(values))]}).
+				Pluck(fk.ReferencedColumn, existing.Interface()).Error
+			if err != nil {
+				return err
+			}
+			for i := 0; i < existing.Elem().Len(); i++ {
+				if value := existing.Elem().Index(i); !value.IsNil() {
+					found[importKey(value.Elem().Interface())] = true
+				}
+			}
+		}
+
+		for _, row := range rows {
+			value := row.values[col.DbName]
+			if value != nil && !found[importKey(value)] {
+				report.Errors = append(report.Errors, ImportError{
+					Row:    row.line,
+					Column: col.DbName,
+					Value:  exportText(value),
+					Error:  "not found in " + fk.ReferencedTable.String() + "." + fk.ReferencedColumn,
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// importKey normalizes a value for comparison with the values of the
+// referenced column: numbers by value, so 1.50 matches 1.5, GUIDs in upper
+// case, times as text and strings ignoring case and trailing spaces, as
+// most collations compare them.
+func importKey(value interface{}) string {
+	number := new(big.Rat)
+	switch v := value.(type) {
+	case int64:
+		return number.SetInt64(v).RatString()
+	case float64:
+		if number.SetFloat64(v) != nil {
+			return number.RatString()
+		}
+	case Decimal:
+		if _, ok := number.SetString(string(v)); ok {
+			return number.RatString()
+		}
+	case Date:
+		return time.Time(v).Format(dateFormat)
+	case DateTime:
+		return time.Time(v).UTC().Format(time.RFC3339Nano)
+	case GUID:
+		return strings.ToUpper(string(v))
+	case string:
+		return strings.ToLower(strings.TrimRight(v, " "))
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
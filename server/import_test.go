@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const importSchema = `
+CREATE TABLE categories (id INTEGER PRIMARY KEY, code DECIMAL(5, 2) UNIQUE, day DATE UNIQUE, name TEXT);
+INSERT INTO categories VALUES (1, 1.5, '2024-01-02', 'tools'), (2, 2, '2024-03-04', 'paint');
+CREATE TABLE products (
+	id INTEGER PRIMARY KEY,
+	name VARCHAR(10) NOT NULL,
+	price DECIMAL(5, 2),
+	stock INTEGER NOT NULL DEFAULT 0,
+	category_id INTEGER REFERENCES categories(id),
+	category_code DECIMAL(5, 2) REFERENCES categories(code),
+	category_day DATE REFERENCES categories(day)
+)`
+
+// serveImport uploads a file to the import endpoint.
+func serveImport(t *testing.T, query string, filename string, content []byte) (int, ImportReport) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/api/tables/products/import"+query, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	initRouter().ServeHTTP(w, req)
+
+	var report ImportReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("%d: %s", w.Code, w.Body)
+	}
+	return w.Code, report
+}
+
+func countProducts(t *testing.T) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Table("products").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestImportValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		csv    string
+		errors []ImportError
+	}{
+		{
+			name: "valid",
+			csv:  "name,price,category_id,category_code,category_day\nhammer,9.75,1,1.50,2024-01-02\nbrush,,2,2.0,2024-03-04\n",
+		},
+		{
+			name: "header matched ignoring case",
+			csv:  "NAME,Stock\nhammer,3\n",
+		},
+		{
+			name: "invalid values",
+			csv:  "name,price,stock\nhammer,cheap,3\nsaw,1.234,x\n,1,1\naveryverylongname,1,1\n",
+			errors: []ImportError{
+				{Row: 2, Column: "price", Value: "cheap", Error: "not a decimal number"},
+				{Row: 3, Column: "price", Value: "1.234", Error: "more than 2 decimal places"},
+				{Row: 3, Column: "stock", Value: "x", Error: "not an integer"},
+				{Row: 4, Column: "name", Error: "value is required"},
+				{Row: 5, Column: "name", Value: "averyverylongname", Error: "longer than 10 characters"},
+			},
+		},
+		{
+			name: "missing required column",
+			csv:  "price\n1\n",
+			errors: []ImportError{
+				{Row: 1, Column: "name", Error: "required column is missing from the file"},
+			},
+		},
+		{
+			name: "missing references",
+			csv:  "name,category_id,category_code,category_day\nhammer,3,1.25,2024-01-03\n",
+			errors: []ImportError{
+				{Row: 2, Column: "category_id", Value: "3", Error: "not found in main.categories.id"},
+				{Row: 2, Column: "category_code", Value: "1.25", Error: "not found in main.categories.code"},
+				{Row: 2, Column: "category_day", Value: "2024-01-03", Error: "not found in main.categories.day"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			openTestDB(t, importSchema)
+
+			code, report := serveImport(t, "?dryRun=true", "products.csv", []byte(test.csv))
+			if code != 200 {
+				t.Fatalf("dry run returned %d", code)
+			}
+			if countProducts(t) != 0 {
+				t.Fatal("dry run inserted rows")
+			}
+
+			want := test.errors
+			if want == nil {
+				want = []ImportError{}
+			}
+			if !reflect.DeepEqual(report.Errors, want) {
+				t.Errorf("got errors %+v, want %+v", report.Errors, want)
+			}
+
+			code, report = serveImport(t, "", "products.csv", []byte(test.csv))
+			switch {
+			case len(want) > 0 && (code != 422 || countProducts(t) != 0):
+				t.Errorf("invalid file returned %d and inserted %d rows", code, countProducts(t))
+			case len(want) == 0 && (code != 200 || int64(report.Inserted) != countProducts(t) || report.Inserted != report.Rows):
+				t.Errorf("valid file returned %d and inserted %d of %d rows", code, report.Inserted, report.Rows)
+			}
+		})
+	}
+}
+
+func TestImportIgnoredColumns(t *testing.T) {
+	openTestDB(t, importSchema)
+
+	_, report := serveImport(t, "?dryRun=true", "products.csv", []byte("id,name,colour\n7,hammer,red\n"))
+	if want := []string{"id", "colour"}; !reflect.DeepEqual(report.IgnoredColumns, want) {
+		t.Errorf("got ignored columns %v, want %v", report.IgnoredColumns, want)
+	}
+}
+
+func TestImportXLSX(t *testing.T) {
+	openTestDB(t, importSchema)
+
+	file := excelize.NewFile()
+	file.SetSheetRow("Sheet1", "A1", &[]interface{}{"name", "price", "category_day"})
+	file.SetSheetRow("Sheet1", "A2", &[]interface{}{"hammer", 9.75, 45293})
+	var content bytes.Buffer
+	if err := file.Write(&content); err != nil {
+		t.Fatal(err)
+	}
+
+	code, report := serveImport(t, "", "products.xlsx", content.Bytes())
+	if code != 200 || report.Inserted != 1 {
+		t.Fatalf("got %d: %+v", code, report)
+	}
+
+	var day Date
+	db.Table("products").Select("category_day").Row().Scan(&day)
+	if got := time.Time(day).Format(dateFormat); got != "2024-01-02" {
+		t.Errorf("spreadsheet date serial imported as %s", got)
+	}
+}
+
+func TestImportReferencesOnlyCheckedWhereReadable(t *testing.T) {
+	openTestDB(t, importSchema)
+	policy = &Policy{Rules: []PolicyRule{{Roles: []string{"*"}, Tables: []string{"products"}, Permissions: []string{"*"}}}}
+
+	// Without read permission on categories, the reference is left to the
+	// database, which does not reveal whether category 3 exists.
+	_, report := serveImport(t, "?dryRun=true", "products.csv", []byte("name,category_id\nhammer,3\n"))
+	if len(report.Errors) != 0 {
+		t.Errorf("got errors %+v", report.Errors)
+	}
+}
@@ -1,10 +1,10 @@
 package main
 
 import (
+	"context"
 	"log"
 	"reflect"
 	"strconv"
-	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -23,6 +23,21 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	auth, err = newAuthenticator(context.Background())
+	if err != nil {
+		log.Fatal("Failed to set up authentication:", err)
+	}
+
+	policy, err = loadPolicy()
+	if err != nil {
+		log.Fatal("Failed to load policy:", err)
+	}
+
+	versionKey, err = loadVersionKey()
+	if err != nil {
+		log.Fatal("Failed to set up row versions:", err)
+	}
+
 	err = initRouter().Run(":8080")
 	if err != nil {
 		log.Fatal(err)
@@ -33,28 +48,46 @@ func main() {
 func initRouter() *gin.Engine {
 	router := gin.Default()
 
+	router.Use(authMiddleware())
 	router.Use(reactMiddleware())
 	router.Use(cors.Default())
 
+	router.GET("/auth/login", login)
+	router.GET("/auth/callback", loginCallback)
+	router.GET("/auth/logout", logout)
+
 	api := router.Group("/api")
 
+	api.GET("/me", getMe)
+
 	api.GET("/tables", getTables)
 
-	tableApi := api.Group("/tables/:table")
+	tableApi := api.Group("/tables/:table", requireExposedTable())
 
-	tableApi.GET("/schema", getSchema)
+	tableApi.GET("/schema", requires(permissionRead), getSchema)
 
-	tableApi.GET("/data", getData)
-	tableApi.POST("/query", dataQuery)
+	tableApi.GET("/data", requires(permissionRead), getData)
+	tableApi.POST("/query", requires(permissionRead), dataQuery)
+	tableApi.POST("/export", requires(permissionRead), exportData)
+	tableApi.POST("/import", requires(permissionCreate), importData)
+	tableApi.POST("/batch", tableBatch)
 	tableApi.GET("/odata", odataEndpoint)
-	tableApi.POST("/data", createData)
-	tableApi.PUT("/data", updateData)
-	tableApi.DELETE("/data", deleteData)
+	tableApi.POST("/data", requires(permissionCreate), createData)
+	tableApi.PUT("/data", requires(permissionUpdate), updateData)
+	tableApi.PATCH("/data", requires(permissionUpdate), patchData)
+	tableApi.DELETE("/data", requires(permissionDelete), deleteData)
 
-	tableApi.GET("/count", getCount)
+	tableApi.GET("/count", requires(permissionRead), getCount)
+
+	api.POST("/batch", batch)
 
 	api.GET("/foreign-keys/:foreignKey/data", getForeignKeys)
 
+	odataApi := api.Group("/odata")
+	odataApi.GET("/", getODataServiceRoot)
+	odataApi.GET("/$metadata", getODataMetadata)
+	odataApi.GET("/:entitySet", odataEndpoint)
+
 	return router
 }
 
@@ -66,10 +99,35 @@ func getForeignKeys(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "Foreign key not found"})
 		return
 	}
+	if _, ok := lookupTable(fkMapping.ReferencedTable); !ok {
+		c.JSON(404, gin.H{"error": "Table " + fkMapping.ReferencedTable.String() + " not found"})
+		return
+	}
+	if !authorize(c, fkMapping.ReferencedTable, permissionRead) {
+		return
+	}
+
+	restrictions, err := restrictColumns(currentUser(c), fkMapping.ReferencedTable)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := rowFilter(currentUser(c), fkMapping.ReferencedTable)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	for _, column := range []string{fkMapping.ReferencedColumn, "name"} {
+		if restrictions.hidden(column) || restrictions.masked(column) {
+			c.JSON(403, gin.H{"error": "Permission denied: read on column " + column})
+			return
+		}
+	}
 
 	data := make([]map[string]interface{}, 0)
 
-	result := db.Table(fkMapping.ReferencedTable).
+	result := tableStatement(db, fkMapping.ReferencedTable).Where(filter).
 		Select(fkMapping.ReferencedColumn + " AS id, name").
 		Limit(100).Find(&data)
 	if result.Error != nil {
@@ -90,86 +148,78 @@ func getForeignKeys(c *gin.Context) {
 	c.JSON(200, data)
 }
 
-func generateFilterStatement(field string, filterType string, value interface{}, endValue interface{}) (interface{}, interface{}, interface{}) {
-	switch filterType {
-	case "equals":
-		return field + " = ?", value, nil
-	case "notEqual":
-		return field + " != ?", value, nil
-	case "greaterThan":
-		return field + " > ?", value, nil
-	case "lessThan":
-		return field + " < ?", value, nil
-	case "greaterThanOrEqual":
-		return field + " >= ?", value, nil
-	case "lessThanOrEqual":
-		return field + " <= ?", value, nil
-	case "contains":
-		return field + " LIKE ?", "%" + value.(string) + "%", nil
-	case "inRange":
-		return field + " BETWEEN ? AND ?", value, endValue
-	case "blank":
-		return field + " IS NULL", nil, nil
-	case "notBlank":
-		return field + " IS NOT NULL", nil, nil
-	}
-
-	return nil, nil, nil
-
+// QueryRequest is the body of the query and export endpoints.
+type QueryRequest struct {
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+	Filters []FilterNode `json:"filters"`
+	Where   *FilterNode  `json:"where"`
+	Sort    []SortColumn `json:"sort"`
+	// Cursor selects keyset paging; "" requests the first page.
+	Cursor *string `json:"cursor"`
 }
 
-func dataQuery(c *gin.Context) {
-	type QueryRequest struct {
-		Limit   int `json:"limit"`
-		Offset  int `json:"offset"`
-		Filters []struct {
-			Field      string      `json:"field"`
-			Type       string      `json:"type"`
-			Filter     interface{} `json:"filter"`
-			FilterTo   interface{} `json:"filterTo"`
-			Operator   string      `json:"operator"`
-			Conditions []struct {
-				Filter interface{} `json:"filter"`
-				Type   string      `json:"type"`
-			}
-		} `json:"filters"`
+// filterTree combines the flat AG Grid filter list and the expression tree,
+// which must all hold.
+func (r QueryRequest) filterTree() FilterNode {
+	where := FilterNode{Operator: "AND", Children: r.Filters}
+	if r.Where != nil {
+		where.Children = append(where.Children, *r.Where)
 	}
+	return where
+}
 
+func dataQuery(c *gin.Context) {
 	var req QueryRequest
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	table := c.Param("table")
-	stmt := db.Table(table)
+	table := tableParam(c)
+
+	restrictions, err := restrictColumns(currentUser(c), table)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := rowFilter(currentUser(c), table)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	stmt := tableStatement(db, table).Where(filter)
 
 	limit := req.Limit
 	if limit == 0 {
 		limit = 100
 	}
+	if limit < 0 {
+		c.JSON(400, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
 	offset := req.Offset
 
-	for _, filter := range req.Filters {
-		if !isColumnNameValid(table, filter.Field) {
-			c.JSON(400, gin.H{"error": "Invalid column name in filter: " + filter.Field})
-			return
-		}
+	condition, err := compileFilter(table, req.filterTree())
+	if err == nil {
+		err = restrictions.checkQuery(req.filterTree(), req.Sort)
+	}
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
 	}
+	stmt = stmt.Where(condition)
 
-	for _, filter := range req.Filters {
-		if filter.Operator == "OR" {
-			stmt = stmt.
-				Where(generateFilterStatement(filter.Field, filter.Conditions[0].Type, filter.Conditions[0].Filter, filter.FilterTo)).
-				Or(generateFilterStatement(filter.Field, filter.Conditions[1].Type, filter.Conditions[1].Filter, filter.FilterTo))
-		} else {
-			stmt = stmt.Where(generateFilterStatement(filter.Field, filter.Type, filter.Filter, filter.FilterTo))
-		}
+	ordering, err := resolveOrdering(table, req.Sort, restrictions)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
 	}
 
 	genStructType := getStructSchema(table)
 	sliceType := reflect.SliceOf(genStructType)
-	data := reflect.New(sliceType).Interface()
+	data := reflect.New(sliceType)
 
 	var count int64
 	result := stmt.Count(&count)
@@ -178,26 +228,57 @@ func dataQuery(c *gin.Context) {
 		return
 	}
 
-	stmt = stmt.Limit(limit).Offset(offset)
-	result = stmt.Find(data)
+	stmt = applyOrdering(stmt, ordering)
+	if req.Cursor == nil {
+		stmt = stmt.Limit(limit).Offset(offset)
+	} else {
+		if *req.Cursor != "" {
+			stmt, err = applyCursor(stmt, table, ordering, *req.Cursor)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		stmt = stmt.Limit(limit + 1)
+	}
+
+	result = stmt.Find(data.Interface())
 	if result.Error != nil {
 		c.JSON(500, gin.H{"error": result.Error.Error()})
 		return
 	}
+	if err := stampVersions(table, data.Elem()); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Cursor == nil {
+		c.JSON(200, gin.H{
+			"data":  restrictions.rows(data.Elem()),
+			"count": count,
+		})
+		return
+	}
+
+	rows, next, err := cursorPage(table, ordering, data.Elem(), limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(200, gin.H{
-		"data":  data,
-		"count": count,
+		"data":       restrictions.rows(rows),
+		"count":      count,
+		"nextCursor": next,
 	})
-
 }
 
 func getData(c *gin.Context) {
-	table := c.Param("table")
+	table := tableParam(c)
 
 	limitStr := c.DefaultQuery("limit", "100")
 	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
+	if err != nil || limit <= 0 {
 		c.JSON(400, gin.H{"error": "Invalid limit parameter"})
 		return
 	}
@@ -209,205 +290,133 @@ func getData(c *gin.Context) {
 		return
 	}
 
-	genStructType := getStructSchema(table)
-	sliceType := reflect.SliceOf(genStructType)
-	data := reflect.New(sliceType).Interface()
-
-	err = db.Table(table).Limit(limit).Offset(offset).Find(data).Error
+	restrictions, err := restrictColumns(currentUser(c), table)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(200, data)
-}
-
-func odataEndpoint(c *gin.Context) {
-	table := c.Param("table")
-	stmt := db.Table(table)
-
-	genStructType := getStructSchema(table)
-	sliceType := reflect.SliceOf(genStructType)
-	data := reflect.New(sliceType).Interface()
-
-	limitStr := c.DefaultQuery("$top", "100")
-	limit, err := strconv.Atoi(limitStr)
+	filter, err := rowFilter(currentUser(c), table)
 	if err != nil {
-		c.JSON(400, gin.H{"error": "Invalid limit parameter"})
+		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	offsetStr := c.DefaultQuery("$skip", "0")
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil {
-		c.JSON(400, gin.H{"error": "Invalid offset parameter"})
+	sort := parseOrderBy(c.Query("sort"))
+	if err := restrictions.checkQuery(FilterNode{}, sort); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	filter := c.Query("$filter")
-	if filter == "" {
-		result := stmt.Limit(limit).Offset(offset).Find(data)
-		if result.Error != nil {
-			c.JSON(500, gin.H{"error": result.Error.Error()})
-			return
-		}
-
-		c.JSON(200, data)
+	ordering, err := resolveOrdering(table, sort, restrictions)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	filers := strings.Split(filter, " and ")
-	conditions := make(map[string][]map[string]interface{})
-
-	for _, f := range filers {
-		parts := strings.SplitN(f, " ", 3)
-
-		if len(parts) == 3 {
-			if !isColumnNameValid(table, parts[0]) {
-				c.JSON(400, gin.H{"error": "Invalid column name in filter: " + parts[0]})
+	genStructType := getStructSchema(table)
+	sliceType := reflect.SliceOf(genStructType)
+	data := reflect.New(sliceType)
+
+	stmt := applyOrdering(tableStatement(db, table).Where(filter), ordering)
+
+	// With a cursor parameter, an empty one for the first page, rows are
+	// paged by key and the next cursor is returned in X-Next-Cursor.
+	cursor, useCursor := c.GetQuery("cursor")
+	if !useCursor {
+		stmt = stmt.Limit(limit).Offset(offset)
+	} else {
+		if cursor != "" {
+			stmt, err = applyCursor(stmt, table, ordering, cursor)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
 				return
 			}
-
-			condition := map[string]interface{}{
-				parts[0]: strings.Trim(parts[2], "'"),
-			}
-
-			conditions[parts[1]] = append(conditions[parts[1]], condition)
 		}
+		stmt = stmt.Limit(limit + 1)
 	}
 
-	equalConditions, exists := conditions["eq"]
-	if exists {
-		for _, cond := range equalConditions {
-			stmt = stmt.Where(cond)
-		}
+	err = stmt.Find(data.Interface()).Error
+	if err == nil {
+		err = stampVersions(table, data.Elem())
 	}
-
-	notEqualConditions, exists := conditions["ne"]
-	if exists {
-		for _, cond := range notEqualConditions {
-			stmt = stmt.Not(cond)
-		}
-	}
-
-	greaterConditions, exists := conditions["gt"]
-	if exists {
-		for _, cond := range greaterConditions {
-			for k, v := range cond {
-				stmt = stmt.Where(k+" > ?", v)
-			}
-		}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
 	}
 
-	lesserConditions, exists := conditions["lt"]
-	if exists {
-		for _, cond := range lesserConditions {
-			for k, v := range cond {
-				stmt = stmt.Where(k+" < ?", v)
-			}
-		}
+	if !useCursor {
+		c.JSON(200, restrictions.rows(data.Elem()))
+		return
 	}
 
-	greaterEqualConditions, exists := conditions["ge"]
-	if exists {
-		for _, cond := range greaterEqualConditions {
-			for k, v := range cond {
-				stmt = stmt.Where(k+" >= ?", v)
-			}
-		}
+	rows, next, err := cursorPage(table, ordering, data.Elem(), limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
 	}
 
-	lesserEqualConditions, exists := conditions["le"]
-	if exists {
-		for _, cond := range lesserEqualConditions {
-			for k, v := range cond {
-				stmt = stmt.Where(k+" <= ?", v)
-			}
-		}
-	}
+	c.Header("X-Next-Cursor", next)
+	c.JSON(200, restrictions.rows(rows))
+}
 
-	likeConditions, exists := conditions["like"]
-	if exists {
-		for _, cond := range likeConditions {
-			for k, v := range cond {
-				stmt = stmt.Where(k+" LIKE ?", v)
-			}
-		}
+func createData(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
 	}
 
-	result := stmt.Limit(limit).Offset(offset).Find(data)
-	if result.Error != nil {
-		c.JSON(500, gin.H{"error": result.Error.Error()})
+	row, keys, err := insertRow(db, currentUser(c), tableParam(c), body)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(200, data)
-
+	c.JSON(200, gin.H{"status": "success", "keys": keys, "data": row})
 }
 
-func createData(c *gin.Context) {
-	table := c.Param("table")
-
-	genStructType := getStructSchema(table)
-	structData := reflect.New(genStructType).Interface()
-
-	if err := c.BindJSON(structData); err != nil {
+func updateData(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	data := convertGormStructToMap(structData)
-
-	result := db.Table(table).Create(&data)
-	if result.Error != nil {
-		c.JSON(500, gin.H{"error": result.Error.Error()})
+	row, err := updateRow(db, currentUser(c), tableParam(c), body)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(200, gin.H{"status": "success"})
+	c.JSON(200, gin.H{"status": "success", "data": row})
 }
 
-func updateData(c *gin.Context) {
-	table := c.Param("table")
-
-	genStructType := getStructSchema(table)
-	structData := reflect.New(genStructType).Interface()
-
-	if err := c.BindJSON(structData); err != nil {
+func patchData(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	data := convertGormStructToMap(structData)
-	primaryKeys := retrievePrimaryKeyValues(structData)
-
-	log.Println("Upserting data:", data)
-
-	result := db.Table(table).Where(primaryKeys).Updates(data)
-	if result.Error != nil {
-		c.JSON(500, gin.H{"error": result.Error.Error()})
+	row, err := patchRow(db, currentUser(c), tableParam(c), body)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(200, gin.H{"status": "success"})
+	c.JSON(200, gin.H{"status": "success", "data": row})
 }
 
 func deleteData(c *gin.Context) {
-	table := c.Param("table")
-
-	genStructType := getStructSchema(table)
-	structData := reflect.New(genStructType).Interface()
-
-	if err := c.BindJSON(structData); err != nil {
+	body, err := c.GetRawData()
+	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	primaryKeys := retrievePrimaryKeyValues(structData)
-
-	result := db.Table(table).Where(primaryKeys).Delete(nil)
-	if result.Error != nil {
-		c.JSON(500, gin.H{"error": result.Error.Error()})
+	if err := deleteRow(db, currentUser(c), tableParam(c), body); err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -415,9 +424,16 @@ func deleteData(c *gin.Context) {
 }
 
 func getCount(c *gin.Context) {
-	table := c.Param("table")
+	table := tableParam(c)
+
+	filter, err := rowFilter(currentUser(c), table)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
 	var count int64
-	result := db.Table(table).Count(&count)
+	result := tableStatement(db, table).Where(filter).Count(&count)
 	if result.Error != nil {
 		c.JSON(500, gin.H{"error": result.Error.Error()})
 		return
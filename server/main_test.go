@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// openTestDB points the server at a new SQLite database holding schema and
+// resets the state shared by the handlers.
+func openTestDB(t *testing.T, schema string) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	viper.Set("DB_DIALECT", "sqlite")
+	viper.Set("DATABASE", filepath.Join(t.TempDir(), "test.db"))
+
+	var err error
+	db, err = connectToDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range strings.Split(schema, ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+
+	tableCache = sync.Map{}
+	columnCache = sync.Map{}
+	schemaCache = sync.Map{}
+	foreignKeyCache = sync.Map{}
+	tableScanned = time.Time{}
+	auth = nil
+	policy = nil
+	versionKey = []byte("test")
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		viper.Reset()
+	})
+}
+
+// serve sends a request through the router. token is sent as bearer token
+// unless it is empty.
+func serve(t *testing.T, method string, target string, body string, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	initRouter().ServeHTTP(w, req)
+	return w
+}
@@ -3,14 +3,19 @@ package main
 import (
 	"log"
 	"os"
+	"path"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -24,9 +29,195 @@ var metadataLogger = logger.New(
 	},
 )
 
+// TableRef identifies a table by schema and name. Routes address tables as
+// "schema.name"; a bare name refers to the connection's default schema.
+type TableRef struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+}
+
+func (t TableRef) String() string {
+	return t.Schema + "." + t.Name
+}
+
+var defaultSchema string
+
+func parseTableRef(qualifiedName string) TableRef {
+	schema, name := splitQualifiedName(qualifiedName)
+	return TableRef{Schema: schema, Name: name}
+}
+
+func splitQualifiedName(qualifiedName string) (string, string) {
+	if schema, name, ok := strings.Cut(qualifiedName, "."); ok {
+		return schema, name
+	}
+	return defaultSchema, qualifiedName
+}
+
+func tableParam(c *gin.Context) TableRef {
+	return parseTableRef(c.Param("table"))
+}
+
+// tableStatement starts a statement against the quoted, schema-qualified
+// table. Statement.Table is set to the bare name so gorm can still qualify
+// columns in generated conditions.
+func tableStatement(tx *gorm.DB, table TableRef) *gorm.DB {
+	stmt := tx.Table("?.?", clause.Table{Name: table.Schema}, clause.Table{Name: table.Name})
+	stmt.Statement.Table = table.Name
+	return stmt
+}
+
+// TableInfo describes a listed table or view. Views are read-only unless
+// they are declared in UPDATABLE_VIEWS. Permissions are those of the caller
+// the table is listed for.
+type TableInfo struct {
+	TableRef
+	Type        string   `json:"type"`
+	Updatable   bool     `json:"updatable"`
+	Permissions []string `json:"permissions,omitempty" gorm:"-"`
+}
+
+// The metadata caches are shared by all requests. tableCache maps a TableRef
+// to its TableInfo, columnCache to its []SchemaColumn and schemaCache to its
+// generated struct type; foreignKeyCache maps constraint names to FkMapping.
+var (
+	tableCache      sync.Map
+	columnCache     sync.Map
+	schemaCache     sync.Map
+	foreignKeyCache sync.Map
+)
+
+// tableRescanInterval is how long lookupTable trusts the last catalog scan
+// before looking for new tables again, so that requests for unknown tables
+// cannot each cost a scan.
+const tableRescanInterval = 30 * time.Second
+
+var (
+	tableScan    sync.Mutex
+	tableScanned time.Time
+)
+
+func retrieveTables() ([]TableInfo, error) {
+	tables, err := dialect.Tables(db.Session(&gorm.Session{Logger: metadataLogger}))
+	if err != nil {
+		return nil, err
+	}
+
+	updatableViews := make(map[TableRef]bool)
+	for _, name := range configList("UPDATABLE_VIEWS") {
+		updatableViews[parseTableRef(name)] = true
+	}
+
+	exposed := tables[:0]
+	for _, table := range tables {
+		if !exposedTable(table.TableRef) {
+			continue
+		}
+		table.Updatable = table.Type == "table" || updatableViews[table.TableRef]
+		tableCache.Store(table.TableRef, table)
+		exposed = append(exposed, table)
+	}
+
+	return exposed, nil
+}
+
+// exposedTable reports whether a table is served at all. INCLUDE_TABLES
+// and EXCLUDE_TABLES hold comma separated table patterns, matched like the
+// tables of policy rules; when INCLUDE_TABLES is set only matching tables
+// are served, and tables matching EXCLUDE_TABLES never are.
+func exposedTable(table TableRef) bool {
+	if include := configList("INCLUDE_TABLES"); len(include) > 0 && !matchesTablePattern(include, table) {
+		return false
+	}
+	return !matchesTablePattern(configList("EXCLUDE_TABLES"), table)
+}
+
+// configList reads a comma separated setting.
+func configList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(viper.GetString(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// matchesTablePattern matches a table against path.Match patterns, ignoring
+// case. Patterns name "schema.table", or the bare table name in any schema
+// when they have no schema, so "sales.*" selects a whole schema.
+func matchesTablePattern(patterns []string, table TableRef) bool {
+	for _, pattern := range patterns {
+		name := table.String()
+		if !strings.Contains(pattern, ".") {
+			name = table.Name
+		}
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// requireExposedTable answers 404 for tables that are not served, before
+// any handler of the table API runs.
+func requireExposedTable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		table := tableParam(c)
+		if _, ok := lookupTable(table); !ok {
+			c.AbortWithStatusJSON(404, gin.H{"error": "Table " + table.String() + " not found"})
+		}
+	}
+}
+
+func lookupTable(table TableRef) (TableInfo, bool) {
+	if info, ok := tableCache.Load(table); ok {
+		return info.(TableInfo), true
+	}
+
+	rescanTables()
+
+	if info, ok := tableCache.Load(table); ok {
+		return info.(TableInfo), true
+	}
+	return TableInfo{}, false
+}
+
+// rescanTables caches tables created since the last scan, scanning at most
+// once per tableRescanInterval.
+func rescanTables() {
+	tableScan.Lock()
+	defer tableScan.Unlock()
+
+	if time.Since(tableScanned) < tableRescanInterval {
+		return
+	}
+	if _, err := retrieveTables(); err != nil {
+		log.Println("Error retrieving tables:", err)
+		return
+	}
+	tableScanned = time.Now()
+}
+
+// checkWritable rejects writes to views that were not declared updatable.
+func checkWritable(table TableRef) error {
+	info, ok := lookupTable(table)
+	if ok && !info.Updatable {
+		return statusError{405, "Table " + table.String() + " is a read-only view"}
+	}
+	return nil
+}
+
+func ensureWritable(c *gin.Context, table TableRef) bool {
+	if err := checkWritable(table); err != nil {
+		respondError(c, err)
+		return false
+	}
+	return true
+}
+
 func getTables(c *gin.Context) {
-	var tables []string
-	err := db.Raw("SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE'").Scan(&tables).Error
+	tables, err := visibleTables(c)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
@@ -36,69 +227,64 @@ func getTables(c *gin.Context) {
 }
 
 func getSchema(c *gin.Context) {
-	table := c.Param("table")
+	table := tableParam(c)
 
-	type DbColumn struct {
-		Name       string `json:"name" gorm:"column:DbName"`
-		DbType     string `json:"db_type" gorm:"column:DbType"`
-		Key        int    `json:"keyColumn" gorm:"column:Key"`
-		ForeignKey string `json:"foreignKey" gorm:"column:ForeignKey"`
-	}
 	type Column struct {
-		Name       string `json:"name"`
-		Type       string `json:"type"`
-		Key        bool   `json:"key"`
-		Filter     bool   `json:"filterable"`
-		ForeignKey string `json:"foreignKeyName" gorm:"column:ForeignKey"`
+		Name       string  `json:"name"`
+		Type       string  `json:"type"`
+		DbType     string  `json:"dbType"`
+		Key        bool    `json:"key"`
+		Filter     bool    `json:"filterable"`
+		ForeignKey string  `json:"foreignKeyName"`
+		Nullable   bool    `json:"nullable"`
+		Ordinal    int     `json:"ordinal"`
+		MaxLength  *int64  `json:"maxLength"`
+		Precision  *int64  `json:"precision"`
+		Scale      *int64  `json:"scale"`
+		Default    *string `json:"default"`
+		Identity   bool    `json:"identity"`
+		Computed   bool    `json:"computed"`
+		ReadOnly   bool    `json:"readOnly"`
+		Masked     bool    `json:"masked"`
 	}
 	type TableSchema struct {
 		Columns []Column `json:"columns"`
 	}
 
-	query := `
-	SELECT 
-		c.COLUMN_NAME                                                                AS DbName,
-       	c.DATA_TYPE                                                                  AS DbType,
-       	CASE WHEN tc.CONSTRAINT_TYPE = 'PRIMARY KEY' THEN 1 ELSE 0 END     AS "Key",
-       	CASE WHEN tc.CONSTRAINT_TYPE = 'FOREIGN KEY' THEN k.CONSTRAINT_NAME END AS ForeignKey
-	FROM INFORMATION_SCHEMA.COLUMNS c
-         LEFT JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE k
-                   ON c.TABLE_NAME = k.TABLE_NAME
-                       AND c.COLUMN_NAME = k.COLUMN_NAME
-                       AND c.TABLE_SCHEMA = k.TABLE_SCHEMA
-         LEFT JOIN INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc
-                   ON k.TABLE_NAME = tc.TABLE_NAME
-                       AND k.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
-                       AND k.TABLE_SCHEMA = tc.TABLE_SCHEMA
-                       AND tc.CONSTRAINT_TYPE IN ('PRIMARY KEY', 'FOREIGN KEY')
-	WHERE c.TABLE_NAME = ?
-	`
-
-	var dbColumns []DbColumn
-	err := db.Raw(query, table).Scan(&dbColumns).Error
+	dbColumns, err := retrieveSchema(table)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	restrictions, err := restrictColumns(currentUser(c), table)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
 	var columns []Column
-	for _, dbCol := range dbColumns {
+	for _, dbCol := range restrictions.visible(dbColumns) {
 		var column Column
-		column.Name = dbCol.Name
-		column.Type = dbCol.DbType
-		column.Key = dbCol.Key == 1
+		column.Name = dbCol.DbName
+		column.Type = dbCol.FrontendType
+		column.DbType = dbCol.DbType
+		column.Key = dbCol.Key
 		column.ForeignKey = dbCol.ForeignKey
-
-		switch dbCol.DbType {
-		case "int", "bigint", "smallint", "tinyint", "decimal", "numeric", "float", "real", "money", "smallmoney":
-			column.Type = "number"
-		case "char", "varchar", "text", "nchar", "nvarchar", "ntext":
-			column.Type = "text"
-		}
-
-		switch dbCol.DbType {
-		case "int", "varchar":
-			column.Filter = true
+		column.Nullable = dbCol.Nullable
+		column.Ordinal = dbCol.Ordinal
+		column.MaxLength = dbCol.MaxLength
+		column.Precision = dbCol.Precision
+		column.Scale = dbCol.Scale
+		column.Default = dbCol.Default
+		column.Identity = dbCol.Identity
+		column.Computed = dbCol.Computed
+		column.ReadOnly = !restrictions.writable(dbCol.DbName)
+		column.Masked = restrictions.masked(dbCol.DbName)
+
+		switch dbCol.FrontendType {
+		case "number", "text":
+			column.Filter = dbCol.GoType != "binary" && !column.Masked
 		default:
 			column.Filter = false
 		}
@@ -111,53 +297,45 @@ func getSchema(c *gin.Context) {
 }
 
 type SchemaColumn struct {
-	StructName string
-	DbName     string
-	DbType     string
-	GoType     string
-	ForeignKey string
-	Key        bool
-}
-
-func retrieveSchema(table string) ([]SchemaColumn, error) {
-	query := `
-		SELECT
-    		c.COLUMN_NAME AS DbName,
-    		c.DATA_TYPE AS DbType,
-    		MAX(CASE WHEN tc.CONSTRAINT_TYPE = 'PRIMARY KEY' THEN 1 ELSE 0 END) AS "Key",
-    		MAX(CASE WHEN tc.CONSTRAINT_TYPE = 'FOREIGN KEY' THEN k.CONSTRAINT_NAME END) AS ForeignKey
-		FROM INFORMATION_SCHEMA.COLUMNS c
-		LEFT JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE k
-    		ON c.TABLE_NAME = k.TABLE_NAME
-    		AND c.COLUMN_NAME = k.COLUMN_NAME
-    		AND c.TABLE_SCHEMA = k.TABLE_SCHEMA
-		LEFT JOIN INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc
-    		ON k.TABLE_NAME = tc.TABLE_NAME
-    		AND k.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
-    		AND k.TABLE_SCHEMA = tc.TABLE_SCHEMA
-    		AND tc.CONSTRAINT_TYPE IN ('PRIMARY KEY', 'FOREIGN KEY')
-		WHERE c.TABLE_NAME = ?
-		GROUP BY c.COLUMN_NAME, c.DATA_TYPE;
-	`
-
-	var columns []SchemaColumn
-	err := db.Session(&gorm.Session{Logger: metadataLogger}).Raw(query, table).Scan(&columns).Error
+	StructName   string
+	DbName       string
+	DbType       string
+	GoType       string
+	FrontendType string
+	ForeignKey   string
+	Key          bool
+	Nullable     bool
+	Ordinal      int
+	MaxLength    *int64
+	Precision    *int64
+	Scale        *int64
+	Default      *string
+	Identity     bool
+	Computed     bool
+	RowVersion   bool
+}
+
+// ReadOnly reports whether the database generates the column's value, so it
+// is never written by INSERT or UPDATE.
+func (c SchemaColumn) ReadOnly() bool {
+	return c.Identity || c.Computed || c.RowVersion
+}
+
+func retrieveSchema(table TableRef) ([]SchemaColumn, error) {
+	columns, err := dialect.Columns(db.Session(&gorm.Session{Logger: metadataLogger}), table)
 	if err != nil {
 		return nil, err
 	}
 
 	for i, col := range columns {
 		columns[i].StructName = cases.Title(language.English).String(col.DbName)
-
-		columns[i].Key = col.Key
-
-		switch col.DbType {
-		case "int", "bigint", "smallint", "tinyint", "decimal", "numeric", "float", "real", "money", "smallmoney":
-			columns[i].GoType = "int"
-		case "char", "varchar", "text", "nchar", "nvarchar", "ntext":
-			columns[i].GoType = "string"
-		default:
-			columns[i].GoType = "interface{}"
+		columns[i].GoType, columns[i].FrontendType = dialect.MapType(col.DbType)
+		// SQL Server and PostgreSQL report -1 for unbounded (MAX) lengths.
+		if col.MaxLength != nil && *col.MaxLength < 0 {
+			columns[i].MaxLength = nil
+		}
+		if col.ForeignKey != "" {
+			columns[i].ForeignKey = table.Schema + "." + col.ForeignKey
 		}
 	}
 
@@ -165,15 +343,13 @@ func retrieveSchema(table string) ([]SchemaColumn, error) {
 }
 
 type FkMapping struct {
-	ReferencedTable  string
+	ReferencedTable  TableRef
 	ReferencedColumn string
 }
 
-var foreignKeyCache = make(map[string]FkMapping)
-
 func cacheForeignKeys(foreignKeyName string) FkMapping {
-	if cachedFk, ok := foreignKeyCache[foreignKeyName]; ok {
-		return cachedFk
+	if cachedFk, ok := foreignKeyCache.Load(foreignKeyName); ok {
+		return cachedFk.(FkMapping)
 
 	} else {
 		fkMap, err := retrieveForeignKeys(foreignKeyName)
@@ -181,48 +357,14 @@ func cacheForeignKeys(foreignKeyName string) FkMapping {
 			log.Println("Error retrieving foreign keys:", err)
 			return FkMapping{}
 		}
-		foreignKeyCache[foreignKeyName] = fkMap
+		foreignKeyCache.Store(foreignKeyName, fkMap)
 		return fkMap
 	}
 }
 
 func retrieveForeignKeys(foreignKeyName string) (FkMapping, error) {
-	query := `
-	SELECT
-    	fk.CONSTRAINT_NAME AS FOREIGN_KEY_NAME,
-    	fk.TABLE_NAME AS FOREIGN_TABLE,
-    	fk.COLUMN_NAME AS FOREIGN_COLUMN,
-    	pk.TABLE_NAME AS REFERENCED_TABLE,
-    	pk.COLUMN_NAME AS REFERENCED_COLUMN
-	FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE fk
-	JOIN INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS rc
-    	ON fk.CONSTRAINT_NAME = rc.CONSTRAINT_NAME
-	JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE pk
-    	ON pk.CONSTRAINT_NAME = rc.UNIQUE_CONSTRAINT_NAME
-    	AND pk.ORDINAL_POSITION = fk.ORDINAL_POSITION
-	WHERE fk.CONSTRAINT_NAME = ?;
-	`
-
-	type ForeignKey struct {
-		ForeignKeyName   string `gorm:"column:FOREIGN_KEY_NAME"`
-		ForeignTable     string `gorm:"column:FOREIGN_TABLE"`
-		ForeignColumn    string `gorm:"column:FOREIGN_COLUMN"`
-		ReferencedTable  string `gorm:"column:REFERENCED_TABLE"`
-		ReferencedColumn string `gorm:"column:REFERENCED_COLUMN"`
-	}
-
-	var foreignKeys ForeignKey
-	result := db.Session(&gorm.Session{Logger: metadataLogger}).Raw(query, foreignKeyName).Find(&foreignKeys)
-	if result.Error != nil {
-		return FkMapping{}, result.Error
-	}
-
-	fkMap := FkMapping{
-		ReferencedTable:  foreignKeys.ReferencedTable,
-		ReferencedColumn: foreignKeys.ReferencedColumn,
-	}
-
-	return fkMap, nil
+	schema, name := splitQualifiedName(foreignKeyName)
+	return dialect.ForeignKey(db.Session(&gorm.Session{Logger: metadataLogger}), schema, name)
 }
 
 func retrievePrimaryKeyValues(data interface{}) map[string]interface{} {
@@ -236,7 +378,7 @@ func retrievePrimaryKeyValues(data interface{}) map[string]interface{} {
 		gormTags := parseGormTag(field.Tag)
 		if _, ok := gormTags["primaryKey"]; ok {
 			columnName := gormTags["column"]
-			resultMap[columnName] = val.Field(i).Interface()
+			resultMap[columnName] = fieldValue(val.Field(i))
 		}
 
 	}
@@ -244,8 +386,8 @@ func retrievePrimaryKeyValues(data interface{}) map[string]interface{} {
 	return resultMap
 }
 
-func isColumnNameValid(table string, column string) bool {
-	columns, err := retrieveSchema(table)
+func isColumnNameValid(table TableRef, column string) bool {
+	columns, err := getSchemaColumns(table)
 	if err != nil {
 		return false
 	}
@@ -262,6 +404,21 @@ func isColumnNameValid(table string, column string) bool {
 	return false
 }
 
+func lookupColumn(table TableRef, column string) (SchemaColumn, bool) {
+	columns, err := getSchemaColumns(table)
+	if err != nil {
+		return SchemaColumn{}, false
+	}
+
+	for _, col := range columns {
+		if col.DbName == column {
+			return col, true
+		}
+	}
+
+	return SchemaColumn{}, false
+}
+
 func convertGormStructToMap(data interface{}) map[string]interface{} {
 	result := make(map[string]interface{})
 	val := reflect.ValueOf(data).Elem()
@@ -270,12 +427,73 @@ func convertGormStructToMap(data interface{}) map[string]interface{} {
 	for i := 0; i < val.NumField(); i++ {
 		field := typ.Field(i)
 		gormTags := parseGormTag(field.Tag)
-		columnName := gormTags["column"]
-		result[columnName] = val.Field(i).Interface()
+		columnName, ok := gormTags["column"]
+		if !ok {
+			continue
+		}
+		result[columnName] = fieldValue(val.Field(i))
 	}
 	return result
 }
 
+// fieldValue dereferences the pointer fields used for optional columns.
+func fieldValue(value reflect.Value) interface{} {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	return value.Interface()
+}
+
+// insertValues keeps the columns an INSERT may set. Generated columns are
+// never sent, and columns with a default are left out when no value was
+// given so the database default applies.
+func insertValues(columns []SchemaColumn, data map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, col := range columns {
+		value, ok := data[col.DbName]
+		if !ok || col.ReadOnly() || (value == nil && col.Default != nil) {
+			continue
+		}
+		values[col.DbName] = value
+	}
+	return values
+}
+
+// updateValues keeps the columns an UPDATE may set: everything except the
+// primary key, which identifies the row, and generated columns.
+func updateValues(columns []SchemaColumn, data map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, col := range columns {
+		value, ok := data[col.DbName]
+		if !ok || col.Key || col.ReadOnly() {
+			continue
+		}
+		values[col.DbName] = value
+	}
+	return values
+}
+
+func columnNames(columns []SchemaColumn) []string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.DbName
+	}
+	return names
+}
+
+func keyColumnNames(columns []SchemaColumn) []string {
+	var keys []string
+	for _, col := range columns {
+		if col.Key {
+			keys = append(keys, col.DbName)
+		}
+	}
+	return keys
+}
+
 func parseGormTag(tag reflect.StructTag) map[string]string {
 	result := make(map[string]string)
 	gormTag := tag.Get("gorm")
@@ -290,40 +508,52 @@ func parseGormTag(tag reflect.StructTag) map[string]string {
 	return result
 }
 
-var schemaCache = make(map[string]reflect.Type)
+func getSchemaColumns(table TableRef) ([]SchemaColumn, error) {
+	if cachedColumns, ok := columnCache.Load(table); ok {
+		return cachedColumns.([]SchemaColumn), nil
+	}
 
-func getStructSchema(table string) reflect.Type {
-	var genStructType reflect.Type
-	if cachedType, ok := schemaCache[table]; ok {
-		genStructType = cachedType
-	} else {
-		genStructType = createStructTypeBasedOnSchema(table).(reflect.Type)
-		schemaCache[table] = genStructType
+	columns, err := retrieveSchema(table)
+	if err != nil {
+		return nil, err
 	}
-	return genStructType
+	cachedColumns, _ := columnCache.LoadOrStore(table, columns)
+	return cachedColumns.([]SchemaColumn), nil
 }
 
-func createStructTypeBasedOnSchema(table string) reflect.Type {
-	columns, err := retrieveSchema(table)
+func getStructSchema(table TableRef) reflect.Type {
+	if cachedType, ok := schemaCache.Load(table); ok {
+		return cachedType.(reflect.Type)
+	}
+
+	cachedType, _ := schemaCache.LoadOrStore(table, createStructTypeBasedOnSchema(table))
+	return cachedType.(reflect.Type)
+}
+
+func createStructTypeBasedOnSchema(table TableRef) reflect.Type {
+	columns, err := getSchemaColumns(table)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	var structFields []reflect.StructField
 	for _, col := range columns {
-		var fieldType reflect.Type
-		switch col.GoType {
-		case "int":
-			fieldType = reflect.TypeOf(0)
-		case "string":
-			fieldType = reflect.TypeOf("")
-		default:
-			fieldType = reflect.TypeOf(new(interface{})).Elem()
+		fieldType, ok := goTypes[col.GoType]
+		if !ok {
+			fieldType = goTypes["interface{}"]
+		}
+
+		// Nullable columns use pointer fields so NULL round-trips as JSON null
+		// instead of collapsing into the zero value, as do columns the client
+		// may omit on insert. Interfaces and byte slices can already hold nil.
+		optional := col.Nullable || col.Default != nil || col.ReadOnly()
+		if optional && fieldType.Kind() != reflect.Interface && fieldType.Kind() != reflect.Slice {
+			fieldType = reflect.PointerTo(fieldType)
 		}
 
 		tags := `json:"` + col.DbName + `"`
 		if col.Key {
-			tags += `gorm:"column:` + col.DbName + `;primaryKey;autoIncrement:false"`
+			tags += `gorm:"column:` + col.DbName + `;primaryKey;autoIncrement:` + strconv.FormatBool(col.Identity) + `"`
 		} else {
 			tags += `gorm:"column:` + col.DbName + `"`
 		}
@@ -336,6 +566,13 @@ func createStructTypeBasedOnSchema(table string) reflect.Type {
 		structFields = append(structFields, structField)
 	}
 
+	// The row version is not a column; see version.go.
+	structFields = append(structFields, reflect.StructField{
+		Name: versionField,
+		Type: reflect.TypeOf(""),
+		Tag:  `json:"_version,omitempty" gorm:"-"`,
+	})
+
 	genStruct := reflect.StructOf(structFields)
 
 	return genStruct
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestConcurrentTableLookups(t *testing.T) {
+	openTestDB(t, `CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			serve(t, http.MethodGet, "/api/tables", "", "")
+		}()
+		go func() {
+			defer wg.Done()
+			if w := serve(t, http.MethodGet, "/api/tables/items/count", "", ""); w.Code != 200 {
+				t.Errorf("count returned %d: %s", w.Code, w.Body)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestUnknownTablesDoNotRescanTheCatalog(t *testing.T) {
+	openTestDB(t, `CREATE TABLE items (id INTEGER PRIMARY KEY)`)
+
+	if w := serve(t, http.MethodGet, "/api/tables/missing/count", "", ""); w.Code != 404 {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+	scanned := tableScanned
+
+	db.Exec(`CREATE TABLE later (id INTEGER PRIMARY KEY)`)
+	if w := serve(t, http.MethodGet, "/api/tables/later/count", "", ""); w.Code != 404 {
+		t.Fatalf("expected 404 until the rescan interval passed, got %d", w.Code)
+	}
+	if !tableScanned.Equal(scanned) {
+		t.Fatal("catalog was scanned again within the rescan interval")
+	}
+
+	tableScanned = time.Time{}
+	if w := serve(t, http.MethodGet, "/api/tables/later/count", "", ""); w.Code != 200 {
+		t.Fatalf("expected 200 after the rescan interval, got %d", w.Code)
+	}
+}
+
+func TestExposedTables(t *testing.T) {
+	tables := []string{"audit_log", "customers", "orders", "tmp_import"}
+
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		want    []string
+	}{
+		{"all tables", "", "", tables},
+		{"include", "cust*, main.orders", "", []string{"customers", "orders"}},
+		{"exclude ignoring case", "", "AUDIT_*,tmp_*", []string{"customers", "orders"}},
+		{"include and exclude", "*", "main.orders", []string{"audit_log", "customers", "tmp_import"}},
+		{"other schema", "sales.*", "", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			openTestDB(t, `
+				CREATE TABLE audit_log (id INTEGER PRIMARY KEY);
+				CREATE TABLE customers (id INTEGER PRIMARY KEY);
+				CREATE TABLE orders (id INTEGER PRIMARY KEY);
+				CREATE TABLE tmp_import (id INTEGER PRIMARY KEY)`)
+			viper.Set("INCLUDE_TABLES", test.include)
+			viper.Set("EXCLUDE_TABLES", test.exclude)
+
+			var listed []TableInfo
+			json.Unmarshal(serve(t, http.MethodGet, "/api/tables", "", "").Body.Bytes(), &listed)
+			var names []string
+			for _, table := range listed {
+				names = append(names, table.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, test.want) {
+				t.Errorf("listed %v, want %v", names, test.want)
+			}
+
+			metadata := serve(t, http.MethodGet, "/api/odata/$metadata", "", "").Body.String()
+			for _, table := range tables {
+				exposed := containsString(test.want, table)
+				if strings.Contains(metadata, `<EntitySet Name="`+table+`"`) != exposed {
+					t.Errorf("$metadata lists %s: %v, want %v", table, !exposed, exposed)
+				}
+
+				status := 404
+				if exposed {
+					status = 200
+				}
+				for _, target := range []string{
+					"/api/tables/" + table + "/data",
+					"/api/tables/" + table + "/schema",
+					"/api/tables/" + table + "/odata",
+					"/api/odata/" + table,
+				} {
+					if w := serve(t, http.MethodGet, target, "", ""); w.Code != status {
+						t.Errorf("%s: got %d, want %d", target, w.Code, status)
+					}
+				}
+			}
+		})
+	}
+}
@@ -11,7 +11,8 @@ import (
 func reactMiddleware() gin.HandlerFunc {
 	return func(context *gin.Context) {
 		switch {
-		case strings.HasPrefix(context.Request.URL.Path, "/api"):
+		case strings.HasPrefix(context.Request.URL.Path, "/api"),
+			strings.HasPrefix(context.Request.URL.Path, "/auth/"):
 			context.Next()
 		case strings.HasPrefix(context.Request.URL.Path, "/static"):
 			context.File("./website" + context.Request.URL.Path)
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// statusError is a failed request together with the HTTP status it is
+// reported with. Other errors are reported as 500.
+type statusError struct {
+	status  int
+	message string
+}
+
+func (e statusError) Error() string {
+	return e.message
+}
+
+func errorStatus(err error) int {
+	var se statusError
+	if errors.As(err, &se) {
+		return se.status
+	}
+	if errors.As(err, &conflictError{}) {
+		return 409
+	}
+	return 500
+}
+
+func respondError(c *gin.Context, err error) {
+	status := errorStatus(err)
+	if status == 405 {
+		c.Header("Allow", "GET")
+	}
+
+	var conflict conflictError
+	if errors.As(err, &conflict) {
+		c.JSON(status, gin.H{"error": err.Error(), "current": conflict.current})
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// The functions below implement the writes of the data endpoints on a given
+// connection or transaction, so that the batch endpoints can combine them.
+
+// insertRow creates a row from its JSON representation and returns the
+// stored row as the user may read it, along with its primary key values.
+func insertRow(tx *gorm.DB, user *User, table TableRef, body []byte) (interface{}, map[string]interface{}, error) {
+	if err := checkWritable(table); err != nil {
+		return nil, nil, err
+	}
+
+	restrictions, err := restrictColumns(user, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter, err := rowFilter(user, table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, nil, statusError{400, err.Error()}
+	}
+	for name, value := range fields {
+		if string(value) == "null" {
+			delete(fields, name)
+		}
+	}
+	if err := restrictions.checkWrite(fields); err != nil {
+		return nil, nil, err
+	}
+
+	genStructType := getStructSchema(table)
+	structData := reflect.New(genStructType).Interface()
+	if err := json.Unmarshal(body, structData); err != nil {
+		return nil, nil, statusError{400, err.Error()}
+	}
+
+	columns, err := getSchemaColumns(table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Rows of a table without a primary key cannot be found again to check
+	// them against the row filter.
+	if filter.SQL != unfiltered && len(keyColumnNames(columns)) == 0 {
+		return nil, nil, statusError{403, "Permission denied: create in " + table.String() + " is not available with a row filter"}
+	}
+
+	data := insertValues(columns, convertGormStructToMap(structData))
+
+	row := reflect.New(genStructType).Interface()
+	var keys map[string]interface{}
+	err = tx.Transaction(func(tx *gorm.DB) error {
+		if err := dialect.Insert(tx, table, columns, data, columnNames(columns), row); err != nil {
+			return err
+		}
+		keys = retrievePrimaryKeyValues(row)
+		return checkRowKept(tx, table, keys, filter)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := stampVersion(table, row); err != nil {
+		return nil, nil, err
+	}
+	return restrictions.row(row), keys, nil
+}
+
+// updateRow replaces the row identified by the primary key values in body
+// and returns the updated row as the user may read it. body must carry the
+// version the client read. Columns the user may not write keep their value
+// and may only be sent back as they were read.
+func updateRow(tx *gorm.DB, user *User, table TableRef, body []byte) (interface{}, error) {
+	if err := checkWritable(table); err != nil {
+		return nil, err
+	}
+
+	restrictions, err := restrictColumns(user, table)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := rowFilter(user, table)
+	if err != nil {
+		return nil, err
+	}
+
+	// Restricted values are set aside before binding the row, since masked
+	// values no longer have the column's type.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, statusError{400, err.Error()}
+	}
+	restricted := make(map[string]json.RawMessage)
+	for name, value := range fields {
+		if col, ok := lookupColumn(table, name); ok && !col.Key && !restrictions.writable(name) {
+			restricted[name] = value
+			delete(fields, name)
+		}
+	}
+	if len(restricted) > 0 {
+		body, _ = json.Marshal(fields)
+	}
+
+	genStructType := getStructSchema(table)
+	structData := reflect.New(genStructType).Interface()
+	if err := json.Unmarshal(body, structData); err != nil {
+		return nil, statusError{400, err.Error()}
+	}
+
+	columns, err := getSchemaColumns(table)
+	if err != nil {
+		return nil, err
+	}
+
+	data := updateValues(columns, convertGormStructToMap(structData))
+	for name := range restrictions {
+		delete(data, name)
+	}
+	primaryKeys := retrievePrimaryKeyValues(structData)
+	if len(primaryKeys) == 0 {
+		return nil, statusError{400, "Table " + table.String() + " has no primary key"}
+	}
+
+	row := reflect.New(genStructType).Interface()
+	err = tx.Transaction(func(tx *gorm.DB) error {
+		if err := checkRowAccess(tx, table, primaryKeys, filter); err != nil {
+			return err
+		}
+		current, err := checkVersion(tx, table, primaryKeys, requestedVersion(structData), restrictions)
+		if err != nil {
+			return err
+		}
+		if err := restrictions.checkUnchanged(restricted, current); err != nil {
+			return err
+		}
+
+		rowsAffected, err := dialect.Update(tx, table, data, primaryKeys, columnNames(columns), row)
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return statusError{404, "Row not found"}
+		}
+		return checkRowKept(tx, table, primaryKeys, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := stampVersion(table, row); err != nil {
+		return nil, err
+	}
+	return restrictions.row(row), nil
+}
+
+// patchRow sets only the columns present in body on the row identified by
+// the primary key values in body and returns the updated row. A _version in
+// body is checked like for updateRow, but may be left out so that edits of
+// different columns do not conflict.
+func patchRow(tx *gorm.DB, user *User, table TableRef, body []byte) (interface{}, error) {
+	if err := checkWritable(table); err != nil {
+		return nil, err
+	}
+
+	restrictions, err := restrictColumns(user, table)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := rowFilter(user, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, statusError{400, err.Error()}
+	}
+
+	for name := range fields {
+		if name == "_version" {
+			continue
+		}
+		col, ok := lookupColumn(table, name)
+		if !ok {
+			return nil, statusError{400, "Invalid column name: " + name}
+		}
+		if col.ReadOnly() && !col.Key {
+			return nil, statusError{400, "Column " + name + " is read-only"}
+		}
+		if !col.Key && !restrictions.writable(name) {
+			return nil, statusError{403, "Permission denied: write on column " + name}
+		}
+	}
+
+	genStructType := getStructSchema(table)
+	structData := reflect.New(genStructType).Interface()
+	if err := json.Unmarshal(body, structData); err != nil {
+		return nil, statusError{400, err.Error()}
+	}
+
+	columns, err := getSchemaColumns(table)
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKeys := retrievePrimaryKeyValues(structData)
+	if len(primaryKeys) == 0 {
+		return nil, statusError{400, "Table " + table.String() + " has no primary key"}
+	}
+	for name := range primaryKeys {
+		if _, ok := fields[name]; !ok {
+			return nil, statusError{400, "Missing key column: " + name}
+		}
+	}
+
+	data := make(map[string]interface{})
+	for name, value := range updateValues(columns, convertGormStructToMap(structData)) {
+		if _, ok := fields[name]; ok {
+			data[name] = value
+		}
+	}
+
+	row := reflect.New(genStructType).Interface()
+	err = tx.Transaction(func(tx *gorm.DB) error {
+		if err := checkRowAccess(tx, table, primaryKeys, filter); err != nil {
+			return err
+		}
+		if version := requestedVersion(structData); version != "" {
+			if _, err := checkVersion(tx, table, primaryKeys, version, restrictions); err != nil {
+				return err
+			}
+		}
+
+		rowsAffected, err := dialect.Update(tx, table, data, primaryKeys, columnNames(columns), row)
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return statusError{404, "Row not found"}
+		}
+		return checkRowKept(tx, table, primaryKeys, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := stampVersion(table, row); err != nil {
+		return nil, err
+	}
+	return restrictions.row(row), nil
+}
+
+// deleteRow removes the row identified by the primary key values in body,
+// which must carry the version the client read.
+func deleteRow(tx *gorm.DB, user *User, table TableRef, body []byte) error {
+	if err := checkWritable(table); err != nil {
+		return err
+	}
+
+	restrictions, err := restrictColumns(user, table)
+	if err != nil {
+		return err
+	}
+	filter, err := rowFilter(user, table)
+	if err != nil {
+		return err
+	}
+
+	structData := reflect.New(getStructSchema(table)).Interface()
+	if err := json.Unmarshal(body, structData); err != nil {
+		return statusError{400, err.Error()}
+	}
+
+	primaryKeys := retrievePrimaryKeyValues(structData)
+	if len(primaryKeys) == 0 {
+		return statusError{400, "Table " + table.String() + " has no primary key"}
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := checkRowAccess(tx, table, primaryKeys, filter); err != nil {
+			return err
+		}
+		if _, err := checkVersion(tx, table, primaryKeys, requestedVersion(structData), restrictions); err != nil {
+			return err
+		}
+		return tableStatement(tx, table).Where(primaryKeys).Delete(nil).Error
+	})
+}
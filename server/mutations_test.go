@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// readRow returns the first row the data endpoint lists.
+func readRow(t *testing.T, table string, token string) map[string]interface{} {
+	t.Helper()
+
+	w := serve(t, http.MethodGet, "/api/tables/"+table+"/data?limit=1", "", token)
+	if w.Code != 200 {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil || len(rows) == 0 {
+		t.Fatalf("no rows in %s", w.Body)
+	}
+	return rows[0]
+}
+
+func jsonBody(t *testing.T, value interface{}) string {
+	t.Helper()
+
+	body, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestWritesWithoutPrimaryKey(t *testing.T) {
+	openTestDB(t, `
+		CREATE TABLE notes (a INTEGER, b TEXT);
+		INSERT INTO notes VALUES (1, 'x'), (2, 'y'), (3, 'z')`)
+
+	row := readRow(t, "notes", "")
+	row["b"] = "changed"
+
+	for _, method := range []string{http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if w := serve(t, method, "/api/tables/notes/data", jsonBody(t, row), ""); w.Code != 400 {
+			t.Errorf("%s returned %d, want 400", method, w.Code)
+		}
+	}
+
+	var changed int64
+	db.Table("notes").Where("b = ?", "changed").Count(&changed)
+	var count int64
+	db.Table("notes").Count(&count)
+	if changed != 0 || count != 3 {
+		t.Errorf("key-less writes changed %d and left %d rows", changed, count)
+	}
+}
+
+func TestPatchColumnSelection(t *testing.T) {
+	openTestDB(t, `
+		CREATE TABLE accounts (
+			id INTEGER PRIMARY KEY,
+			owner TEXT NOT NULL,
+			balance INTEGER NOT NULL,
+			doubled INTEGER GENERATED ALWAYS AS (balance * 2)
+		);
+		INSERT INTO accounts (id, owner, balance) VALUES (1, 'ada', 100)`)
+
+	version := readRow(t, "accounts", "")["_version"]
+
+	// A change made after the client read the row survives a patch of
+	// another column sent without _version.
+	db.Exec(`UPDATE accounts SET owner = 'grace'`)
+
+	w := serve(t, http.MethodPatch, "/api/tables/accounts/data", `{"id": 1, "balance": 150}`, "")
+	if w.Code != 200 {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Data["owner"] != "grace" || response.Data["balance"] != 150.0 || response.Data["doubled"] != 300.0 {
+		t.Errorf("unexpected row after patch: %v", response.Data)
+	}
+
+	tests := []struct {
+		name   string
+		body   interface{}
+		status int
+	}{
+		{"unknown column", map[string]interface{}{"id": 1, "colour": "red"}, 400},
+		{"generated column", map[string]interface{}{"id": 1, "doubled": 4}, 400},
+		{"missing key", map[string]interface{}{"balance": 1}, 400},
+		{"missing row", map[string]interface{}{"id": 2, "balance": 1}, 404},
+		{"stale version", map[string]interface{}{"id": 1, "balance": 1, "_version": version}, 409},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := serve(t, http.MethodPatch, "/api/tables/accounts/data", jsonBody(t, test.body), ""); w.Code != test.status {
+				t.Errorf("got %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+		})
+	}
+
+	var owner string
+	var balance int64
+	db.Table("accounts").Select("owner, balance").Row().Scan(&owner, &balance)
+	if owner != "grace" || balance != 150 {
+		t.Errorf("rejected patches changed the row to %s, %d", owner, balance)
+	}
+}
@@ -0,0 +1,733 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// odataPageSize is the number of entities per response. Clients follow
+// @odata.nextLink for the rest.
+const odataPageSize = 100
+
+// odataServiceRoot is the path every OData context and link is relative to.
+const odataServiceRoot = "/api/odata/"
+
+func odataEndpoint(c *gin.Context) {
+	table, ok := odataTable(c)
+	if !ok {
+		c.JSON(404, gin.H{"error": "Entity set " + c.Param("entitySet") + " not found"})
+		return
+	}
+	if !authorize(c, table, permissionRead) {
+		return
+	}
+
+	restrictions, err := restrictColumns(currentUser(c), table)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := rowFilter(currentUser(c), table)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	stmt := tableStatement(db, table).Where(filter)
+
+	top := -1
+	if value, ok := c.GetQuery("$top"); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(400, gin.H{"error": "Invalid $top parameter"})
+			return
+		}
+		top = parsed
+	}
+
+	skip, err := strconv.Atoi(c.DefaultQuery("$skip", "0"))
+	if err != nil || skip < 0 {
+		c.JSON(400, gin.H{"error": "Invalid $skip parameter"})
+		return
+	}
+
+	if filter := c.Query("$filter"); filter != "" {
+		node, err := parseODataFilter(filter)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid $filter: " + err.Error()})
+			return
+		}
+
+		condition, err := compileFilter(table, node)
+		if err == nil {
+			err = restrictions.checkQuery(node, nil)
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		stmt = stmt.Where(condition)
+	}
+
+	var selected []string
+	if selectParam := c.Query("$select"); selectParam != "" && selectParam != "*" {
+		for _, field := range strings.Split(selectParam, ",") {
+			field = strings.TrimSpace(field)
+			if !isColumnNameValid(table, field) || restrictions.hidden(field) {
+				c.JSON(400, gin.H{"error": "Invalid column name in $select: " + field})
+				return
+			}
+			selected = append(selected, field)
+		}
+	}
+
+	sort := parseOrderBy(c.Query("$orderby"))
+	err = restrictions.checkQuery(FilterNode{}, sort)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	ordering, err := resolveOrdering(table, sort, restrictions)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"@odata.context": odataContext(c, table, selected)}
+
+	switch c.Query("$count") {
+	case "true":
+		var count int64
+		if err := stmt.Count(&count).Error; err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		response["@odata.count"] = count
+	case "", "false":
+	default:
+		c.JSON(400, gin.H{"error": "Invalid $count parameter"})
+		return
+	}
+
+	// One row beyond the page tells whether a next link is needed.
+	limit := odataPageSize
+	if top >= 0 && top <= odataPageSize {
+		limit = top
+	}
+
+	genStructType := getStructSchema(table)
+	data := reflect.New(reflect.SliceOf(genStructType))
+
+	// Requests without $skip are paged by key: next links carry a
+	// $skiptoken cursor instead of a growing offset.
+	_, useSkip := c.GetQuery("$skip")
+	stmt = applyOrdering(stmt, ordering)
+	if skiptoken := c.Query("$skiptoken"); skiptoken != "" {
+		if useSkip {
+			c.JSON(400, gin.H{"error": "$skip and $skiptoken cannot be combined"})
+			return
+		}
+		stmt, err = applyCursor(stmt, table, ordering, skiptoken)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err = stmt.Limit(limit + 1).Offset(skip).Find(data.Interface()).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, next, err := cursorPage(table, ordering, data.Elem(), limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if next != "" && (top < 0 || top > limit) {
+		if useSkip {
+			next = ""
+		}
+		response["@odata.nextLink"] = odataNextLink(c, skip+limit, next, top-limit)
+	}
+
+	switch {
+	case selected != nil:
+		response["value"] = projectRows(rows, selected, restrictions)
+	case len(restrictions) > 0:
+		columns, err := getSchemaColumns(table)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		response["value"] = projectRows(rows, columnNames(restrictions.visible(columns)), restrictions)
+	default:
+		response["value"] = rows.Interface()
+	}
+
+	c.JSON(200, response)
+}
+
+// projectRows converts the rows to maps holding only the given columns, as
+// the caller may read them.
+func projectRows(rows reflect.Value, columns []string, restrictions columnRestrictions) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		row := convertGormStructToMap(rows.Index(i).Addr().Interface())
+		projected := make(map[string]interface{}, len(columns))
+		for _, column := range columns {
+			projected[column] = restrictions.value(column, row[column])
+		}
+		result = append(result, projected)
+	}
+	return result
+}
+
+// odataTable resolves the table of /api/tables/:table/odata, or the entity
+// set of /api/odata/:entitySet.
+func odataTable(c *gin.Context) (TableRef, bool) {
+	name := c.Param("entitySet")
+	if name == "" {
+		return tableParam(c), true
+	}
+
+	tables, err := retrieveTables()
+	if err != nil {
+		return TableRef{}, false
+	}
+	for _, table := range tables {
+		if entitySetName(table.TableRef) == name {
+			return table.TableRef, true
+		}
+	}
+	return TableRef{}, false
+}
+
+// entitySetName names the table in OData URLs. Tables outside the default
+// schema are prefixed with their schema, since entity set names cannot
+// contain dots.
+func entitySetName(table TableRef) string {
+	if table.Schema == defaultSchema {
+		return odataName(table.Name)
+	}
+	return odataName(table.Schema + "_" + table.Name)
+}
+
+var odataInvalidIdentifierChars = regexp.MustCompile(`[^\p{L}\p{N}_]`)
+
+// odataName replaces the characters OData does not allow in names.
+func odataName(name string) string {
+	return odataInvalidIdentifierChars.ReplaceAllString(name, "_")
+}
+
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := c.GetHeader("X-Forwarded-Proto"); forwarded != "" {
+		scheme = forwarded
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func odataContext(c *gin.Context, table TableRef, selected []string) string {
+	context := requestBaseURL(c) + odataServiceRoot + "$metadata#" + entitySetName(table)
+	if selected != nil {
+		context += "(" + strings.Join(selected, ",") + ")"
+	}
+	return context
+}
+
+// odataNextLink repeats the current request from the skiptoken cursor, or
+// from skip if there is none. A remaining count of zero or less means no
+// $top was requested.
+func odataNextLink(c *gin.Context, skip int, skiptoken string, remaining int) string {
+	query := c.Request.URL.Query()
+	if skiptoken != "" {
+		query.Set("$skiptoken", skiptoken)
+	} else {
+		query.Set("$skip", strconv.Itoa(skip))
+	}
+	if remaining > 0 {
+		query.Set("$top", strconv.Itoa(remaining))
+	}
+	// $ is valid in a query string and keeps the link readable.
+	return requestBaseURL(c) + c.Request.URL.Path + "?" + strings.ReplaceAll(query.Encode(), "%24", "$")
+}
+
+// parseODataFilter translates an OData v4 $filter expression into a filter
+// tree. Supported are the logical operators and, or and not, parentheses,
+// the comparison operators eq, ne, gt, ge, lt and le, the in operator, the
+// functions contains, startswith and endswith (optionally on tolower(field)),
+// and null, boolean, numeric, string, date, datetime and guid literals.
+func parseODataFilter(filter string) (FilterNode, error) {
+	tokens, err := tokenizeOData(filter)
+	if err != nil {
+		return FilterNode{}, err
+	}
+
+	p := &odataParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return FilterNode{}, err
+	}
+	if p.peek().kind != odataEOF {
+		return FilterNode{}, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+	return node, nil
+}
+
+type odataTokenKind int
+
+const (
+	odataEOF odataTokenKind = iota
+	odataIdentifier
+	odataLiteral
+	odataOpenParen
+	odataCloseParen
+	odataComma
+)
+
+type odataToken struct {
+	kind  odataTokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+var (
+	odataGUIDPattern     = regexp.MustCompile(`^[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}$`)
+	odataDatePattern     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	odataDateTimePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T`)
+	odataIntPattern      = regexp.MustCompile(`^-?\d+[Ll]?$`)
+	odataDecimalPattern  = regexp.MustCompile(`^-?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?([MmDdFf])?$`)
+)
+
+func isODataWordChar(r byte) bool {
+	return r == '_' || r == '.' || r == ':' || r == '-' || r == '+' ||
+		(r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func tokenizeOData(input string) ([]odataToken, error) {
+	var tokens []odataToken
+	i := 0
+	for i < len(input) {
+		ch := input[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '(':
+			tokens = append(tokens, odataToken{kind: odataOpenParen, text: "(", pos: i})
+			i++
+		case ch == ')':
+			tokens = append(tokens, odataToken{kind: odataCloseParen, text: ")", pos: i})
+			i++
+		case ch == ',':
+			tokens = append(tokens, odataToken{kind: odataComma, text: ",", pos: i})
+			i++
+		case ch == '\'':
+			text, end, err := scanODataString(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, odataToken{kind: odataLiteral, text: input[i:end], value: text, pos: i})
+			i = end
+		case isODataWordChar(ch):
+			start := i
+			for i < len(input) && isODataWordChar(input[i]) {
+				i++
+			}
+			word := input[start:i]
+
+			// Prefixed literals such as datetime'2024-01-01T00:00:00Z'.
+			if i < len(input) && input[i] == '\'' {
+				text, end, err := scanODataString(input, i)
+				if err != nil {
+					return nil, err
+				}
+				value, err := parseODataTypedLiteral(strings.ToLower(word), text)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, odataToken{kind: odataLiteral, text: input[start:end], value: value, pos: start})
+				i = end
+				continue
+			}
+
+			token, err := classifyODataWord(word)
+			if err != nil {
+				return nil, err
+			}
+			token.pos = start
+			tokens = append(tokens, token)
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", ch, i)
+		}
+	}
+
+	return append(tokens, odataToken{kind: odataEOF, text: "end of expression", pos: len(input)}), nil
+}
+
+// scanODataString reads a single quoted string starting at start, where two
+// quotes stand for one. It returns the unquoted text and the end offset.
+func scanODataString(input string, start int) (string, int, error) {
+	var text strings.Builder
+	for i := start + 1; i < len(input); i++ {
+		if input[i] != '\'' {
+			text.WriteByte(input[i])
+			continue
+		}
+		if i+1 < len(input) && input[i+1] == '\'' {
+			text.WriteByte('\'')
+			i++
+			continue
+		}
+		return text.String(), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("unterminated string starting at position %d", start)
+}
+
+func classifyODataWord(word string) (odataToken, error) {
+	literal := func(value interface{}) (odataToken, error) {
+		return odataToken{kind: odataLiteral, text: word, value: value}, nil
+	}
+
+	switch {
+	case word == "null":
+		return literal(nil)
+	case word == "true":
+		return literal(true)
+	case word == "false":
+		return literal(false)
+	case odataGUIDPattern.MatchString(word):
+		return literal(strings.ToUpper(word))
+	case odataDatePattern.MatchString(word):
+		return parseODataTypedLiteralToken(word, "date")
+	case odataDateTimePattern.MatchString(word):
+		return parseODataTypedLiteralToken(word, "datetimeoffset")
+	case odataIntPattern.MatchString(word):
+		value, err := strconv.ParseInt(strings.TrimRight(word, "Ll"), 10, 64)
+		if err != nil {
+			return odataToken{}, fmt.Errorf("invalid number %s", word)
+		}
+		return literal(value)
+	case odataDecimalPattern.MatchString(word):
+		text := strings.TrimRight(word, "MmDdFf")
+		if strings.HasSuffix(word, "M") || strings.HasSuffix(word, "m") {
+			return literal(Decimal(text))
+		}
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return odataToken{}, fmt.Errorf("invalid number %s", word)
+		}
+		return literal(value)
+	case word[0] == '_' || (word[0] >= 'a' && word[0] <= 'z') || (word[0] >= 'A' && word[0] <= 'Z'):
+		if strings.ContainsAny(word, ".:+-") {
+			return odataToken{}, fmt.Errorf("invalid identifier %s", word)
+		}
+		return odataToken{kind: odataIdentifier, text: word}, nil
+	}
+
+	return odataToken{}, fmt.Errorf("invalid literal %s", word)
+}
+
+func parseODataTypedLiteralToken(text string, typeName string) (odataToken, error) {
+	value, err := parseODataTypedLiteral(typeName, text)
+	return odataToken{kind: odataLiteral, text: text, value: value}, err
+}
+
+func parseODataTypedLiteral(typeName string, text string) (interface{}, error) {
+	switch typeName {
+	case "date":
+		t, err := time.Parse(dateFormat, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date literal %s", text)
+		}
+		return Date(t), nil
+	case "datetime", "datetimeoffset":
+		t, err := parseTime(text, time.RFC3339Nano)
+		if err != nil {
+			return nil, fmt.Errorf("invalid datetime literal %s", text)
+		}
+		return t, nil
+	case "guid":
+		if !odataGUIDPattern.MatchString(text) {
+			return nil, fmt.Errorf("invalid guid literal %s", text)
+		}
+		return strings.ToUpper(text), nil
+	}
+	return nil, fmt.Errorf("unsupported literal type %s", typeName)
+}
+
+type odataParser struct {
+	tokens []odataToken
+	pos    int
+	depth  int
+}
+
+func (p *odataParser) peek() odataToken {
+	return p.tokens[p.pos]
+}
+
+func (p *odataParser) next() odataToken {
+	token := p.tokens[p.pos]
+	if token.kind != odataEOF {
+		p.pos++
+	}
+	return token
+}
+
+// keyword consumes the next token if it is the given operator keyword.
+func (p *odataParser) keyword(name string) bool {
+	token := p.peek()
+	if token.kind == odataIdentifier && strings.EqualFold(token.text, name) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *odataParser) expect(kind odataTokenKind, what string) (odataToken, error) {
+	token := p.next()
+	if token.kind != kind {
+		return token, fmt.Errorf("expected %s at position %d, found %q", what, token.pos, token.text)
+	}
+	return token, nil
+}
+
+func (p *odataParser) parseOr() (FilterNode, error) {
+	return p.parseBinary("or", p.parseAnd)
+}
+
+func (p *odataParser) parseAnd() (FilterNode, error) {
+	return p.parseBinary("and", p.parseUnary)
+}
+
+func (p *odataParser) parseBinary(operator string, operand func() (FilterNode, error)) (FilterNode, error) {
+	first, err := operand()
+	if err != nil {
+		return FilterNode{}, err
+	}
+
+	children := []FilterNode{first}
+	for p.keyword(operator) {
+		next, err := operand()
+		if err != nil {
+			return FilterNode{}, err
+		}
+		children = append(children, next)
+	}
+
+	if len(children) == 1 {
+		return first, nil
+	}
+	return FilterNode{Operator: strings.ToUpper(operator), Children: children}, nil
+}
+
+func (p *odataParser) parseUnary() (FilterNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxFilterDepth {
+		return FilterNode{}, fmt.Errorf("expression is nested deeper than %d levels", maxFilterDepth)
+	}
+
+	if p.keyword("not") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return FilterNode{}, err
+		}
+		return FilterNode{Operator: "NOT", Children: []FilterNode{operand}}, nil
+	}
+
+	if p.peek().kind == odataOpenParen {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return FilterNode{}, err
+		}
+		if _, err := p.expect(odataCloseParen, ")"); err != nil {
+			return FilterNode{}, err
+		}
+		return node, nil
+	}
+
+	token := p.peek()
+	if token.kind == odataIdentifier && p.tokens[p.pos+1].kind == odataOpenParen {
+		switch strings.ToLower(token.text) {
+		case "contains", "startswith", "endswith":
+			return p.parseStringFunction()
+		}
+	}
+
+	return p.parseComparison()
+}
+
+// odataOperand is a column reference, possibly wrapped in tolower or
+// toupper, or a literal value.
+type odataOperand struct {
+	field      string
+	ignoreCase bool
+	value      interface{}
+}
+
+func (p *odataParser) parseOperand() (odataOperand, error) {
+	token := p.next()
+	switch token.kind {
+	case odataLiteral:
+		return odataOperand{value: token.value}, nil
+	case odataIdentifier:
+		name := strings.ToLower(token.text)
+		if (name == "tolower" || name == "toupper") && p.peek().kind == odataOpenParen {
+			p.next()
+			field, err := p.expect(odataIdentifier, "column name")
+			if err != nil {
+				return odataOperand{}, err
+			}
+			if _, err := p.expect(odataCloseParen, ")"); err != nil {
+				return odataOperand{}, err
+			}
+			return odataOperand{field: field.text, ignoreCase: true}, nil
+		}
+		if p.peek().kind == odataOpenParen {
+			return odataOperand{}, fmt.Errorf("unsupported function %s at position %d", token.text, token.pos)
+		}
+		return odataOperand{field: token.text}, nil
+	}
+	return odataOperand{}, fmt.Errorf("expected column or literal at position %d, found %q", token.pos, token.text)
+}
+
+var odataComparisons = map[string]string{
+	"eq": "equals",
+	"ne": "notEqual",
+	"gt": "greaterThan",
+	"ge": "greaterThanOrEqual",
+	"lt": "lessThan",
+	"le": "lessThanOrEqual",
+}
+
+// odataMirrored gives the operator to use when the literal is on the left.
+var odataMirrored = map[string]string{"eq": "eq", "ne": "ne", "gt": "lt", "ge": "le", "lt": "gt", "le": "ge"}
+
+func (p *odataParser) parseComparison() (FilterNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return FilterNode{}, err
+	}
+
+	if p.keyword("in") {
+		if left.field == "" {
+			return FilterNode{}, errors.New("the left side of in must be a column")
+		}
+		values, err := p.parseList()
+		if err != nil {
+			return FilterNode{}, err
+		}
+		return FilterNode{Field: left.field, Type: "in", Filter: values}, nil
+	}
+
+	token := p.next()
+	operator := strings.ToLower(token.text)
+	if token.kind != odataIdentifier || odataComparisons[operator] == "" {
+		return FilterNode{}, fmt.Errorf("expected comparison operator at position %d, found %q", token.pos, token.text)
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return FilterNode{}, err
+	}
+
+	if left.field == "" {
+		left, right = right, left
+		operator = odataMirrored[operator]
+	}
+	if left.field == "" || right.field != "" {
+		return FilterNode{}, fmt.Errorf("comparison at position %d must compare a column with a literal", token.pos)
+	}
+
+	if right.value == nil {
+		switch operator {
+		case "eq":
+			return FilterNode{Field: left.field, Type: "blank"}, nil
+		case "ne":
+			return FilterNode{Field: left.field, Type: "notBlank"}, nil
+		}
+		return FilterNode{}, errors.New("null can only be compared with eq or ne")
+	}
+
+	filterType := odataComparisons[operator]
+	if left.ignoreCase {
+		if operator != "eq" && operator != "ne" {
+			return FilterNode{}, errors.New("tolower and toupper can only be compared with eq or ne")
+		}
+		filterType += "IgnoreCase"
+	}
+
+	return FilterNode{Field: left.field, Type: filterType, Filter: right.value}, nil
+}
+
+func (p *odataParser) parseList() ([]interface{}, error) {
+	if _, err := p.expect(odataOpenParen, "("); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, 0)
+	for {
+		token, err := p.expect(odataLiteral, "literal")
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, token.value)
+
+		if p.peek().kind != odataComma {
+			break
+		}
+		p.next()
+	}
+
+	if _, err := p.expect(odataCloseParen, ")"); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (p *odataParser) parseStringFunction() (FilterNode, error) {
+	name := strings.ToLower(p.next().text)
+	p.next()
+
+	field, err := p.parseOperand()
+	if err != nil {
+		return FilterNode{}, err
+	}
+	if field.field == "" {
+		return FilterNode{}, fmt.Errorf("the first argument of %s must be a column", name)
+	}
+
+	if _, err := p.expect(odataComma, ","); err != nil {
+		return FilterNode{}, err
+	}
+
+	value, err := p.expect(odataLiteral, "literal")
+	if err != nil {
+		return FilterNode{}, err
+	}
+	if _, err := p.expect(odataCloseParen, ")"); err != nil {
+		return FilterNode{}, err
+	}
+
+	filterType := map[string]string{"contains": "contains", "startswith": "startsWith", "endswith": "endsWith"}[name]
+	if field.ignoreCase {
+		filterType += "IgnoreCase"
+	}
+
+	return FilterNode{Field: field.field, Type: filterType, Filter: value.value}, nil
+}
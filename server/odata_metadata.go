@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/xml"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// odataNamespace is the schema namespace of the generated entity types.
+const odataNamespace = "EasyDataEntry"
+
+var edmTypes = map[string]string{
+	"int":         "Edm.Int64",
+	"string":      "Edm.String",
+	"decimal":     "Edm.Decimal",
+	"float":       "Edm.Double",
+	"bool":        "Edm.Boolean",
+	"date":        "Edm.Date",
+	"datetime":    "Edm.DateTimeOffset",
+	"time":        "Edm.TimeOfDay",
+	"guid":        "Edm.Guid",
+	"binary":      "Edm.Binary",
+	"interface{}": "Edm.String",
+}
+
+type edmx struct {
+	XMLName      xml.Name        `xml:"edmx:Edmx"`
+	Version      string          `xml:"Version,attr"`
+	Xmlns        string          `xml:"xmlns:edmx,attr"`
+	DataServices edmDataServices `xml:"edmx:DataServices"`
+}
+
+type edmDataServices struct {
+	Schema edmSchema `xml:"Schema"`
+}
+
+type edmSchema struct {
+	Xmlns       string             `xml:"xmlns,attr"`
+	Namespace   string             `xml:"Namespace,attr"`
+	EntityTypes []edmEntityType    `xml:"EntityType"`
+	Container   edmEntityContainer `xml:"EntityContainer"`
+}
+
+type edmEntityType struct {
+	Name       string                  `xml:"Name,attr"`
+	Key        []edmPropertyRef        `xml:"Key>PropertyRef"`
+	Properties []edmProperty           `xml:"Property"`
+	Navigation []edmNavigationProperty `xml:"NavigationProperty"`
+}
+
+type edmPropertyRef struct {
+	Name string `xml:"Name,attr"`
+}
+
+type edmProperty struct {
+	Name      string `xml:"Name,attr"`
+	Type      string `xml:"Type,attr"`
+	Nullable  string `xml:"Nullable,attr,omitempty"`
+	MaxLength string `xml:"MaxLength,attr,omitempty"`
+	Precision string `xml:"Precision,attr,omitempty"`
+	Scale     string `xml:"Scale,attr,omitempty"`
+}
+
+type edmNavigationProperty struct {
+	Name       string                   `xml:"Name,attr"`
+	Type       string                   `xml:"Type,attr"`
+	Nullable   string                   `xml:"Nullable,attr,omitempty"`
+	Constraint edmReferentialConstraint `xml:"ReferentialConstraint"`
+}
+
+type edmReferentialConstraint struct {
+	Property           string `xml:"Property,attr"`
+	ReferencedProperty string `xml:"ReferencedProperty,attr"`
+}
+
+type edmEntityContainer struct {
+	Name       string         `xml:"Name,attr"`
+	EntitySets []edmEntitySet `xml:"EntitySet"`
+}
+
+type edmEntitySet struct {
+	Name     string                         `xml:"Name,attr"`
+	Type     string                         `xml:"EntityType,attr"`
+	Bindings []edmNavigationPropertyBinding `xml:"NavigationPropertyBinding"`
+}
+
+type edmNavigationPropertyBinding struct {
+	Path   string `xml:"Path,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+// getODataServiceRoot lists every readable table as an entity set.
+func getODataServiceRoot(c *gin.Context) {
+	tables, err := visibleTables(c)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	sets := make([]gin.H, 0, len(tables))
+	for _, table := range tables {
+		name := entitySetName(table.TableRef)
+		sets = append(sets, gin.H{"name": name, "kind": "EntitySet", "url": name})
+	}
+
+	c.JSON(200, gin.H{
+		"@odata.context": requestBaseURL(c) + odataServiceRoot + "$metadata",
+		"value":          sets,
+	})
+}
+
+// getODataMetadata describes every readable table as an entity type and
+// entity set in CSDL. Foreign keys become navigation properties, named after
+// the constraint, with a binding to the referenced entity set.
+func getODataMetadata(c *gin.Context) {
+	tables, err := visibleTables(c)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	listed := make(map[TableRef]bool)
+	for _, table := range tables {
+		listed[table.TableRef] = true
+	}
+
+	schema := edmSchema{
+		Xmlns:     "http://docs.oasis-open.org/odata/ns/edm",
+		Namespace: odataNamespace,
+		Container: edmEntityContainer{Name: "Container"},
+	}
+
+	for _, table := range tables {
+		columns, err := getSchemaColumns(table.TableRef)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		name := entitySetName(table.TableRef)
+		entityType := edmEntityType{Name: name}
+		entitySet := edmEntitySet{Name: name, Type: odataNamespace + "." + name}
+
+		restrictions, err := restrictColumns(currentUser(c), table.TableRef)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Entity types need a key; tables without a primary key use their
+		// fallback keys, as ordering does. Key columns are never hidden.
+		keys := keyColumnNames(columns)
+		if len(keys) == 0 {
+			keys = fallbackKeys(columns, restrictions)
+		}
+		for _, key := range keys {
+			entityType.Key = append(entityType.Key, edmPropertyRef{Name: key})
+		}
+
+		for _, col := range restrictions.visible(columns) {
+			entityType.Properties = append(entityType.Properties, edmPropertyFor(col))
+
+			if col.ForeignKey == "" {
+				continue
+			}
+			fk := cacheForeignKeys(col.ForeignKey)
+			if !listed[fk.ReferencedTable] {
+				continue
+			}
+
+			_, navigationName := splitQualifiedName(col.ForeignKey)
+			navigationName = odataName(navigationName)
+			target := entitySetName(fk.ReferencedTable)
+			entityType.Navigation = append(entityType.Navigation, edmNavigationProperty{
+				Name:     navigationName,
+				Type:     odataNamespace + "." + target,
+				Nullable: nullableAttr(col.Nullable),
+				Constraint: edmReferentialConstraint{
+					Property:           col.DbName,
+					ReferencedProperty: fk.ReferencedColumn,
+				},
+			})
+			entitySet.Bindings = append(entitySet.Bindings, edmNavigationPropertyBinding{Path: navigationName, Target: target})
+		}
+
+		schema.EntityTypes = append(schema.EntityTypes, entityType)
+		schema.Container.EntitySets = append(schema.Container.EntitySets, entitySet)
+	}
+
+	document := edmx{
+		Version:      "4.0",
+		Xmlns:        "http://docs.oasis-open.org/odata/ns/edmx",
+		DataServices: edmDataServices{Schema: schema},
+	}
+
+	output, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("OData-Version", "4.0")
+	c.Data(200, "application/xml", append([]byte(xml.Header), output...))
+}
+
+func edmPropertyFor(col SchemaColumn) edmProperty {
+	property := edmProperty{
+		Name:     col.DbName,
+		Type:     edmTypes[col.GoType],
+		Nullable: nullableAttr(col.Nullable),
+	}
+
+	switch col.GoType {
+	case "string", "binary":
+		if col.MaxLength != nil {
+			property.MaxLength = strconv.FormatInt(*col.MaxLength, 10)
+		}
+	case "decimal":
+		if col.Precision != nil {
+			property.Precision = strconv.FormatInt(*col.Precision, 10)
+		}
+		if col.Scale != nil {
+			property.Scale = strconv.FormatInt(*col.Scale, 10)
+		}
+	}
+
+	return property
+}
+
+// nullableAttr renders the Nullable facet, which defaults to true.
+func nullableAttr(nullable bool) string {
+	if nullable {
+		return ""
+	}
+	return "false"
+}
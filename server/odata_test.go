@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseODataFilter(t *testing.T) {
+	openTestDB(t, peopleSchema)
+
+	tests := []struct {
+		filter string
+		want   []int64
+	}{
+		{"name eq 'Ada'", []int64{1}},
+		{"name eq 'O''Brien'", []int64{}},
+		{"age gt 40", []int64{2, 3}},
+		{"40 lt age", []int64{2, 3}},
+		{"age ge 41 and age le 85", []int64{2, 3}},
+		{"age eq null", []int64{4}},
+		{"null ne age", []int64{1, 2, 3}},
+		{"name eq 'Ada' or name eq 'Grace'", []int64{1, 3}},
+		{"not (age gt 40)", []int64{1}},
+		{"age gt 30 and (startswith(name, 'Ad') or endswith(name, 'ce'))", []int64{1, 3}},
+		{"contains(note, '%')", []int64{1}},
+		{"contains(tolower(name), 'la')", []int64{2}},
+		{"tolower(name) eq 'grace'", []int64{3}},
+		{"toupper(name) ne 'ALAN'", []int64{1, 3, 4}},
+		{"id in (1, 4)", []int64{1, 4}},
+		{"born lt 1900-01-01", []int64{1}},
+		{"born eq 1912-06-23", []int64{2}},
+		{"age eq 36.0", []int64{1}},
+		{"age eq 36M", []int64{1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			node, err := parseODataFilter(test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids, err := filterIDs(t, node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("got %v, want %v", ids, test.want)
+			}
+		})
+	}
+}
+
+func TestParseODataFilterErrors(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{"name eq", "expected column or literal"},
+		{"name 'Ada'", "expected comparison operator"},
+		{"name eq 'Ada", "unterminated"},
+		{"name eq 'Ada')", "unexpected"},
+		{"(name eq 'Ada'", "expected )"},
+		{"name eq age", "must compare a column with a literal"},
+		{"1 eq 1", "must compare a column with a literal"},
+		{"age gt null", "null can only be compared"},
+		{"tolower(name) gt 'a'", "tolower and toupper"},
+		{"length(name) eq 3", "unsupported function"},
+		{"1 in (1, 2)", "left side of in"},
+		{"id in (1, age)", "expected literal"},
+		{"contains('Ada', name)", "must be a column"},
+		{"born eq 2024-13-01", "invalid date literal"},
+		{strings.Repeat("not ", maxFilterDepth+1) + "id eq 1", "nested deeper"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			_, err := parseODataFilter(test.filter)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestODataResponse(t *testing.T) {
+	openTestDB(t, peopleSchema)
+
+	query := url.Values{
+		"$filter":  {"age ne null"},
+		"$select":  {"id,name"},
+		"$orderby": {"age desc"},
+		"$count":   {"true"},
+		"$top":     {"2"},
+	}
+	w := serve(t, http.MethodGet, "/api/tables/people/odata?"+query.Encode(), "", "")
+	if w.Code != 200 {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+
+	var response struct {
+		Count    int64                    `json:"@odata.count"`
+		Context  string                   `json:"@odata.context"`
+		NextLink string                   `json:"@odata.nextLink"`
+		Value    []map[string]interface{} `json:"value"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Count != 3 {
+		t.Errorf("got count %d, want 3", response.Count)
+	}
+	want := []map[string]interface{}{{"id": 3.0, "name": "Grace"}, {"id": 2.0, "name": "alan"}}
+	if !reflect.DeepEqual(response.Value, want) {
+		t.Errorf("got %v, want %v", response.Value, want)
+	}
+	if !strings.HasSuffix(response.Context, "$metadata#people(id,name)") {
+		t.Errorf("unexpected @odata.context %q", response.Context)
+	}
+	if response.NextLink != "" {
+		t.Errorf("got @odata.nextLink %q after $top was reached", response.NextLink)
+	}
+}
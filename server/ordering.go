@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SortColumn struct {
+	Field     string `json:"field"`
+	Direction string `json:"direction"`
+}
+
+func (s SortColumn) Desc() bool {
+	return strings.EqualFold(s.Direction, "desc")
+}
+
+// parseOrderBy reads a comma separated list of "column [asc|desc]" items,
+// the format of the OData $orderby option and the sort query parameter.
+func parseOrderBy(orderBy string) []SortColumn {
+	var sort []SortColumn
+	for _, item := range strings.Split(orderBy, ",") {
+		parts := strings.Fields(item)
+		if len(parts) == 0 {
+			continue
+		}
+
+		column := SortColumn{Field: parts[0], Direction: "asc"}
+		if len(parts) > 1 {
+			column.Direction = strings.ToLower(parts[1])
+		}
+		sort = append(sort, column)
+	}
+	return sort
+}
+
+// resolveOrdering validates the requested sort against the table schema and
+// appends the primary key as a tie-breaker, so that paging is deterministic.
+// Tables without one are ordered by their fallback keys instead. Ordering
+// values end up in cursors, so they are only taken from columns the caller
+// may sort by.
+func resolveOrdering(table TableRef, sort []SortColumn, restrictions columnRestrictions) ([]SortColumn, error) {
+	columns, err := getSchemaColumns(table)
+	if err != nil {
+		return nil, err
+	}
+
+	var ordering []SortColumn
+	seen := make(map[string]bool)
+	for _, s := range sort {
+		if !isColumnNameValid(table, s.Field) {
+			return nil, errors.New("Invalid column name in sort: " + s.Field)
+		}
+		if s.Direction == "" {
+			s.Direction = "asc"
+		}
+		if !strings.EqualFold(s.Direction, "asc") && !strings.EqualFold(s.Direction, "desc") {
+			return nil, errors.New("Invalid sort direction: " + s.Direction)
+		}
+		if seen[s.Field] {
+			continue
+		}
+		seen[s.Field] = true
+		ordering = append(ordering, s)
+	}
+
+	keys := keyColumnNames(columns)
+	if len(keys) == 0 {
+		keys = fallbackKeys(columns, restrictions)
+	}
+	for _, key := range keys {
+		if !seen[key] {
+			ordering = append(ordering, SortColumn{Field: key, Direction: "asc"})
+		}
+	}
+
+	return ordering, nil
+}
+
+// fallbackKeys stand in for the primary key of tables without one: every
+// column the caller may sort by. No single column need be unique, and a
+// cursor seeking past a value shared by several rows would skip them. Rows
+// that only differ in hidden or masked columns still cannot be told apart.
+func fallbackKeys(columns []SchemaColumn, restrictions columnRestrictions) []string {
+	var keys []string
+	for _, col := range columns {
+		if restrictions.searchable(col.DbName) {
+			keys = append(keys, col.DbName)
+		}
+	}
+	return keys
+}
+
+func applyOrdering(stmt *gorm.DB, ordering []SortColumn) *gorm.DB {
+	for _, s := range ordering {
+		stmt = stmt.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Field}, Desc: s.Desc()})
+	}
+	return stmt
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// Policy grants roles permissions on tables. It is read from the YAML or
+// JSON file named by POLICY_FILE, for example
+//
+//	rules:
+//	  - roles: [editor]
+//	    tables: ["sales.*", "Customers"]
+//	    permissions: [read, create, update, delete]
+//	  - roles: ["*"]
+//	    tables: ["*"]
+//	    permissions: [read]
+//
+// A caller holds the union of the permissions of every rule matching one of
+// its roles, with "*" matching any caller. Table patterns are matched by
+// matchesTablePattern. Without a policy file every caller may do everything.
+type Policy struct {
+	Rules []PolicyRule `mapstructure:"rules"`
+}
+
+type PolicyRule struct {
+	Roles       []string     `mapstructure:"roles"`
+	Tables      []string     `mapstructure:"tables"`
+	Permissions []string     `mapstructure:"permissions"`
+	Columns     []ColumnRule `mapstructure:"columns"`
+	Rows        *FilterNode  `mapstructure:"rows"`
+}
+
+const (
+	permissionRead   = "read"
+	permissionCreate = "create"
+	permissionUpdate = "update"
+	permissionDelete = "delete"
+)
+
+var permissions = []string{permissionRead, permissionCreate, permissionUpdate, permissionDelete}
+
+// policy is nil when no policy file is configured.
+var policy *Policy
+
+func loadPolicy() (*Policy, error) {
+	file := viper.GetString("POLICY_FILE")
+	if file == "" {
+		log.Println("POLICY_FILE is not set, every caller has full access")
+		return nil, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	if err := v.Unmarshal(&p); err != nil {
+		return nil, err
+	}
+
+	for i, rule := range p.Rules {
+		if len(rule.Roles) == 0 || len(rule.Tables) == 0 {
+			return nil, fmt.Errorf("policy rule %d needs roles and tables", i)
+		}
+		for _, permission := range rule.Permissions {
+			if permission != "*" && !containsString(permissions, permission) {
+				return nil, fmt.Errorf("policy rule %d has invalid permission %q. Valid permissions are: *, %s",
+					i, permission, strings.Join(permissions, ", "))
+			}
+		}
+		for _, pattern := range rule.Tables {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("policy rule %d has invalid table pattern %q", i, pattern)
+			}
+		}
+		for _, columns := range rule.Columns {
+			if err := columns.validate(); err != nil {
+				return nil, fmt.Errorf("policy rule %d: %w", i, err)
+			}
+		}
+	}
+
+	return &p, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (r PolicyRule) matchesUser(user *User) bool {
+	for _, role := range r.Roles {
+		if role == "*" || (user != nil && containsString(user.Roles, role)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r PolicyRule) matchesTable(table TableRef) bool {
+	return matchesTablePattern(r.Tables, table)
+}
+
+// rules returns the rules of the policy that apply to the user and table.
+func (p *Policy) rules(user *User, table TableRef) []PolicyRule {
+	var rules []PolicyRule
+	for _, rule := range p.Rules {
+		if rule.matchesUser(user) && rule.matchesTable(table) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// tablePermissions lists what the user may do with a table.
+func tablePermissions(user *User, table TableRef) []string {
+	if policy == nil {
+		return permissions
+	}
+
+	var granted []string
+	for _, permission := range permissions {
+		for _, rule := range policy.rules(user, table) {
+			if containsString(rule.Permissions, "*") || containsString(rule.Permissions, permission) {
+				granted = append(granted, permission)
+				break
+			}
+		}
+	}
+	return granted
+}
+
+func permitted(user *User, table TableRef, permission string) bool {
+	return containsString(tablePermissions(user, table), permission)
+}
+
+func checkPermission(user *User, table TableRef, permission string) error {
+	if !permitted(user, table, permission) {
+		return statusError{403, "Permission denied: " + permission + " on " + table.String()}
+	}
+	return nil
+}
+
+// authorize responds with 403 unless the caller holds permission on table.
+func authorize(c *gin.Context, table TableRef, permission string) bool {
+	if err := checkPermission(currentUser(c), table, permission); err != nil {
+		respondError(c, err)
+		return false
+	}
+	return true
+}
+
+// requires guards a route of the table API.
+func requires(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authorize(c, tableParam(c), permission) {
+			c.Abort()
+		}
+	}
+}
+
+// visibleTables lists the tables the caller may read.
+func visibleTables(c *gin.Context) ([]TableInfo, error) {
+	tables, err := retrieveTables()
+	if err != nil {
+		return nil, err
+	}
+
+	user := currentUser(c)
+	visible := make([]TableInfo, 0, len(tables))
+	for _, table := range tables {
+		if granted := tablePermissions(user, table.TableRef); containsString(granted, permissionRead) {
+			table.Permissions = granted
+			visible = append(visible, table)
+		}
+	}
+	return visible, nil
+}
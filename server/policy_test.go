@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const notesSchema = `
+CREATE TABLE notes (id INTEGER PRIMARY KEY, text TEXT);
+INSERT INTO notes VALUES (1, 'first'), (2, 'second');
+CREATE TABLE orders (id INTEGER PRIMARY KEY, total INTEGER);
+INSERT INTO orders VALUES (1, 10)`
+
+var notesPolicy = &Policy{Rules: []PolicyRule{
+	{Roles: []string{"*"}, Tables: []string{"main.notes"}, Permissions: []string{permissionRead}},
+	{Roles: []string{"editor"}, Tables: []string{"NOTES"}, Permissions: []string{permissionCreate, permissionUpdate}},
+	{Roles: []string{"admin"}, Tables: []string{"*"}, Permissions: []string{"*"}},
+}}
+
+func TestTablePermissions(t *testing.T) {
+	policy = notesPolicy
+	t.Cleanup(func() { policy = nil })
+
+	notes := TableRef{Schema: "main", Name: "notes"}
+	orders := TableRef{Schema: "main", Name: "orders"}
+
+	tests := []struct {
+		name  string
+		user  *User
+		table TableRef
+		want  []string
+	}{
+		{"anonymous", nil, notes, []string{"read"}},
+		{"no roles", &User{}, orders, nil},
+		{"editor", &User{Roles: []string{"editor"}}, notes, []string{"read", "create", "update"}},
+		{"editor on other table", &User{Roles: []string{"editor"}}, orders, nil},
+		{"admin", &User{Roles: []string{"viewer", "admin"}}, orders, permissions},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tablePermissions(test.user, test.table); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyEnforcement(t *testing.T) {
+	openTestDB(t, notesSchema)
+	issuer := newTestIssuer(t)
+	enableAuth(t, issuer)
+	policy = notesPolicy
+
+	token := func(roles ...string) string {
+		return issuer.token(t, map[string]interface{}{"roles": roles})
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"read", token(), http.MethodGet, "/api/tables/notes/data", "", 200},
+		{"read unlisted table", token(), http.MethodGet, "/api/tables/orders/data", "", 403},
+		{"query unlisted table", token(), http.MethodPost, "/api/tables/orders/query", "{}", 403},
+		{"schema of unlisted table", token(), http.MethodGet, "/api/tables/orders/schema", "", 403},
+		{"create without permission", token(), http.MethodPost, "/api/tables/notes/data", `{"text": "x"}`, 403},
+		{"create", token("editor"), http.MethodPost, "/api/tables/notes/data", `{"text": "x"}`, 200},
+		{"delete without permission", token("editor"), http.MethodDelete, "/api/tables/notes/data", `{"id": 1}`, 403},
+		{"admin reads any table", token("admin"), http.MethodGet, "/api/tables/orders/data", "", 200},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := serve(t, test.method, test.target, test.body, test.token); w.Code != test.status {
+				t.Errorf("got %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+		})
+	}
+
+	w := serve(t, http.MethodGet, "/api/tables", "", token("editor"))
+	var tables []TableInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &tables); err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || tables[0].Name != "notes" || !reflect.DeepEqual(tables[0].Permissions, []string{"read", "create", "update"}) {
+		t.Errorf("got tables %+v, want notes with read, create and update", tables)
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{"rules:\n  - tables: [notes]\n    permissions: [read]\n", "needs roles and tables"},
+		{"rules:\n  - roles: [editor]\n    tables: [notes]\n    permissions: [write]\n", `invalid permission "write"`},
+		{"rules:\n  - roles: [editor]\n    tables: [\"[notes\"]\n", "invalid table pattern"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := os.WriteFile(file, []byte(test.policy), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			viper.Set("POLICY_FILE", file)
+
+			if _, err := loadPolicy(); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A policy rule may limit the rows of its tables with a filter in the form of
+// the query API, where a value "${claim}" stands for the value of a claim of
+// the caller's token, for example
+//
+//	rows:
+//	  field: Region
+//	  type: equals
+//	  filter: ${region}
+//
+// Claims holding a list can be used with in and notIn. A caller may access
+// the rows matching the filter of any rule applying to it, and every row if
+// one of those rules has none. Filters referring to a claim the caller does
+// not have match no rows. Callers with a row filter cannot import rows, nor
+// create rows in tables without a primary key, since those rows cannot be
+// read back to check them against the filter.
+
+var claimReference = regexp.MustCompile(`^\$\{([^}]+)\}$`)
+
+var errMissingClaim = errors.New("missing claim")
+
+// unfiltered is the condition of callers who may access every row.
+const unfiltered = "1 = 1"
+
+// rowFilter returns the condition selecting the rows of table the user may
+// access.
+func rowFilter(user *User, table TableRef) (clause.Expr, error) {
+	if policy == nil {
+		return clause.Expr{SQL: unfiltered}, nil
+	}
+
+	where := FilterNode{Operator: "OR"}
+	for _, rule := range policy.rules(user, table) {
+		if rule.Rows == nil {
+			return clause.Expr{SQL: unfiltered}, nil
+		}
+
+		node, err := bindClaims(*rule.Rows, user)
+		if errors.Is(err, errMissingClaim) {
+			continue
+		}
+		if err != nil {
+			return clause.Expr{}, err
+		}
+		where.Children = append(where.Children, node)
+	}
+
+	return compileFilter(table, where)
+}
+
+// bindClaims replaces the claim references in the values of a filter.
+func bindClaims(node FilterNode, user *User) (FilterNode, error) {
+	var err error
+	if node.Filter, err = claimValue(node.Filter, user); err != nil {
+		return node, err
+	}
+	if node.FilterTo, err = claimValue(node.FilterTo, user); err != nil {
+		return node, err
+	}
+
+	node.Children = append([]FilterNode{}, node.Children...)
+	for i := range node.Children {
+		if node.Children[i], err = bindClaims(node.Children[i], user); err != nil {
+			return node, err
+		}
+	}
+	node.Conditions = append([]FilterNode{}, node.Conditions...)
+	for i := range node.Conditions {
+		if node.Conditions[i], err = bindClaims(node.Conditions[i], user); err != nil {
+			return node, err
+		}
+	}
+	return node, nil
+}
+
+func claimValue(value interface{}, user *User) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	match := claimReference.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return value, nil
+	}
+
+	if user == nil {
+		return nil, errMissingClaim
+	}
+	claim, ok := user.Claims[match[1]]
+	if !ok || claim == nil {
+		return nil, errMissingClaim
+	}
+	return claim, nil
+}
+
+// checkRowAccess verifies that the row identified by where exists and matches
+// the row filter. Rows outside the filter are reported as missing.
+func checkRowAccess(tx *gorm.DB, table TableRef, where map[string]interface{}, filter clause.Expr) error {
+	var count int64
+	if err := tableStatement(tx, table).Where(where).Where(filter).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return statusError{404, "Row not found"}
+	}
+	return nil
+}
+
+// checkRowKept verifies that a written row still matches the row filter, so
+// that rows cannot be moved out of or created outside of it.
+func checkRowKept(tx *gorm.DB, table TableRef, where map[string]interface{}, filter clause.Expr) error {
+	var count int64
+	if err := tableStatement(tx, table).Where(where).Where(filter).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return statusError{403, "Permission denied: the row is outside the rows you may access in " + table.String()}
+	}
+	return nil
+}
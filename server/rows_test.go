@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const ordersSchema = `
+CREATE TABLE orders (id INTEGER PRIMARY KEY, region TEXT NOT NULL, total INTEGER);
+INSERT INTO orders VALUES (1, 'north', 10), (2, 'south', 20), (3, 'north', 30), (4, 'east', 40);
+CREATE TABLE order_notes (region TEXT NOT NULL, note TEXT);
+INSERT INTO order_notes VALUES ('north', 'n')`
+
+// enableRowFilters limits callers to the orders of the region claim of their
+// token, or of the regions claim for auditors, while managers see every row.
+func enableRowFilters(t *testing.T) *testIssuer {
+	t.Helper()
+
+	openTestDB(t, ordersSchema)
+	issuer := newTestIssuer(t)
+	enableAuth(t, issuer)
+	policy = &Policy{Rules: []PolicyRule{
+		{
+			Roles:       []string{"*"},
+			Tables:      []string{"orders", "order_notes"},
+			Permissions: []string{"*"},
+			Rows:        &FilterNode{Field: "region", Type: "equals", Filter: "${region}"},
+		},
+		{
+			Roles:       []string{"auditor"},
+			Tables:      []string{"orders"},
+			Permissions: []string{permissionRead},
+			Rows:        &FilterNode{Field: "region", Type: "in", Filter: " ${regions} "},
+		},
+		{Roles: []string{"manager"}, Tables: []string{"orders"}, Permissions: []string{permissionRead}},
+	}}
+	return issuer
+}
+
+func TestRowFilterOnRead(t *testing.T) {
+	issuer := enableRowFilters(t)
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   []int64
+	}{
+		{"claim", map[string]interface{}{"region": "north"}, []int64{1, 3}},
+		{"missing claim", nil, []int64{}},
+		{"list claim", map[string]interface{}{"roles": []string{"auditor"}, "regions": []string{"south", "east"}}, []int64{2, 4}},
+		{"claim and list claim", map[string]interface{}{"roles": []string{"auditor"}, "region": "north", "regions": []string{"east"}}, []int64{1, 3, 4}},
+		{"unfiltered rule", map[string]interface{}{"roles": []string{"manager"}}, []int64{1, 2, 3, 4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serve(t, http.MethodGet, "/api/tables/orders/data?sort=id", "", issuer.token(t, test.claims))
+			if w.Code != 200 {
+				t.Fatalf("got %d: %s", w.Code, w.Body)
+			}
+			if ids := rowIDs(t, w.Body.Bytes()); !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("got %v, want %v", ids, test.want)
+			}
+
+			w = serve(t, http.MethodGet, "/api/tables/orders/count", "", issuer.token(t, test.claims))
+			if w.Code != 200 {
+				t.Fatalf("count returned %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestRowFilterOnWrite(t *testing.T) {
+	issuer := enableRowFilters(t)
+	north := issuer.token(t, map[string]interface{}{"region": "north"})
+
+	tests := []struct {
+		name   string
+		method string
+		table  string
+		body   string
+		status int
+	}{
+		{"update outside the filter", http.MethodPatch, "orders", `{"id": 2, "total": 0}`, 404},
+		{"delete outside the filter", http.MethodDelete, "orders", `{"id": 2}`, 404},
+		{"move out of the filter", http.MethodPatch, "orders", `{"id": 1, "region": "south"}`, 403},
+		{"create outside the filter", http.MethodPost, "orders", `{"region": "south", "total": 50}`, 403},
+		{"update inside the filter", http.MethodPatch, "orders", `{"id": 3, "total": 31}`, 200},
+		{"create inside the filter", http.MethodPost, "orders", `{"region": "north", "total": 60}`, 200},
+		{"create in a table without key", http.MethodPost, "order_notes", `{"region": "south", "note": "s"}`, 403},
+		{"create in a table without key inside the filter", http.MethodPost, "order_notes", `{"region": "north", "note": "m"}`, 403},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := serve(t, test.method, "/api/tables/"+test.table+"/data", test.body, north); w.Code != test.status {
+				t.Errorf("got %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+		})
+	}
+
+	var totals []int64
+	db.Table("orders").Order("id").Pluck("total", &totals)
+	var regions []string
+	db.Table("orders").Order("id").Pluck("region", &regions)
+	var notes int64
+	db.Table("order_notes").Count(&notes)
+	if !reflect.DeepEqual(totals, []int64{10, 20, 31, 40, 60}) || regions[0] != "north" || notes != 1 {
+		t.Errorf("got totals %v, regions %v and %d notes after the writes", totals, regions, notes)
+	}
+
+	if w := serve(t, http.MethodPatch, "/api/tables/orders/data", `{"id": 3, "total": 0}`, issuer.token(t, nil)); w.Code != 404 {
+		t.Errorf("update without the claim returned %d, want 404", w.Code)
+	}
+}
+
+func TestRowFilterBlocksImport(t *testing.T) {
+	issuer := enableRowFilters(t)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "orders.csv")
+	part.Write([]byte("id,region,total\n7,north,1\n"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tables/orders/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+issuer.token(t, map[string]interface{}{"region": "north"}))
+	w := httptest.NewRecorder()
+	initRouter().ServeHTTP(w, req)
+
+	if w.Code != 403 {
+		t.Errorf("import with a row filter returned %d, want 403: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// Column values are bound to these types so that every supported database
+// round-trips through JSON without losing precision or format.
+//
+//	decimal   Decimal    JSON number, kept as its exact decimal text
+//	float     float64    JSON number
+//	bool      bool       JSON boolean
+//	date      Date       "2006-01-02"
+//	datetime  DateTime   RFC 3339, e.g. "2006-01-02T15:04:05.999Z"
+//	time      TimeOfDay  "15:04:05.9999999"
+//	guid      GUID       "6F9619FF-8B86-D011-B42D-00C04FC964FF"
+//	binary    []byte     base64 string
+var goTypes = map[string]reflect.Type{
+	"int":         reflect.TypeOf(int64(0)),
+	"string":      reflect.TypeOf(""),
+	"decimal":     reflect.TypeOf(Decimal("")),
+	"float":       reflect.TypeOf(float64(0)),
+	"bool":        reflect.TypeOf(false),
+	"date":        reflect.TypeOf(Date{}),
+	"datetime":    reflect.TypeOf(DateTime{}),
+	"time":        reflect.TypeOf(TimeOfDay("")),
+	"guid":        reflect.TypeOf(GUID("")),
+	"binary":      reflect.TypeOf([]byte(nil)),
+	"interface{}": reflect.TypeOf(new(interface{})).Elem(),
+}
+
+const (
+	dateFormat      = "2006-01-02"
+	timeOfDayFormat = "15:04:05.9999999"
+)
+
+var decimalPattern = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+// Decimal holds an exact numeric value as text, so decimal, numeric and
+// money columns are never rounded through a float.
+type Decimal string
+
+func (d *Decimal) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = ""
+	case []byte:
+		*d = Decimal(v)
+	case string:
+		*d = Decimal(v)
+	case int64:
+		*d = Decimal(strconv.FormatInt(v, 10))
+	case float64:
+		*d = Decimal(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return fmt.Errorf("cannot scan %T into Decimal", value)
+	}
+	return nil
+}
+
+func (d Decimal) Value() (driver.Value, error) {
+	return string(d), nil
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if d == "" {
+		return []byte("null"), nil
+	}
+	return []byte(d), nil
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	text := strings.Trim(string(data), `"`)
+	if !decimalPattern.MatchString(text) {
+		return fmt.Errorf("invalid decimal value %s", data)
+	}
+	*d = Decimal(text)
+	return nil
+}
+
+// Date is a calendar date without time of day.
+type Date time.Time
+
+func (d *Date) Scan(value interface{}) error {
+	t, err := scanTime(value, dateFormat)
+	*d = Date(t)
+	return err
+}
+
+func (d Date) Value() (driver.Value, error) {
+	return time.Time(d).Format(dateFormat), nil
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Time(d).Format(dateFormat))
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	t, err := unmarshalTime(data, dateFormat)
+	*d = Date(t)
+	return err
+}
+
+// DateTime is a point in time, serialized as RFC 3339.
+type DateTime time.Time
+
+func (d *DateTime) Scan(value interface{}) error {
+	t, err := scanTime(value, time.RFC3339Nano)
+	*d = DateTime(t)
+	return err
+}
+
+func (d DateTime) Value() (driver.Value, error) {
+	return time.Time(d), nil
+}
+
+func (d DateTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Time(d).Format(time.RFC3339Nano))
+}
+
+func (d *DateTime) UnmarshalJSON(data []byte) error {
+	t, err := unmarshalTime(data, time.RFC3339Nano)
+	*d = DateTime(t)
+	return err
+}
+
+// TimeOfDay is a time without date, kept as "15:04:05.9999999" text.
+type TimeOfDay string
+
+func (t *TimeOfDay) Scan(value interface{}) error {
+	if value == nil {
+		*t = ""
+		return nil
+	}
+	parsed, err := scanTime(value, timeOfDayFormat)
+	*t = TimeOfDay(parsed.Format(timeOfDayFormat))
+	return err
+}
+
+func (t TimeOfDay) Value() (driver.Value, error) {
+	return string(t), nil
+}
+
+func (t *TimeOfDay) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	parsed, err := unmarshalTime(data, timeOfDayFormat)
+	*t = TimeOfDay(parsed.Format(timeOfDayFormat))
+	return err
+}
+
+// GUID is a uniqueidentifier/uuid in its canonical string form.
+type GUID string
+
+func (g *GUID) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*g = ""
+	case []byte:
+		if len(v) == 16 {
+			// SQL Server returns uniqueidentifier in its mixed-endian wire format.
+			var u mssql.UniqueIdentifier
+			if err := u.Scan(v); err != nil {
+				return err
+			}
+			*g = GUID(u.String())
+		} else {
+			*g = GUID(v)
+		}
+	case string:
+		*g = GUID(strings.ToUpper(v))
+	default:
+		return fmt.Errorf("cannot scan %T into GUID", value)
+	}
+	return nil
+}
+
+func (g GUID) Value() (driver.Value, error) {
+	return string(g), nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	dateFormat,
+	timeOfDayFormat,
+}
+
+func parseTime(text string, layout string) (time.Time, error) {
+	if t, err := time.Parse(layout, text); err == nil {
+		return t, nil
+	}
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time value %q, expected format %s", text, layout)
+}
+
+func scanTime(value interface{}, layout string) (time.Time, error) {
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v, nil
+	case []byte:
+		return parseTime(string(v), layout)
+	case string:
+		return parseTime(v, layout)
+	}
+	return time.Time{}, fmt.Errorf("cannot scan %T into a time value", value)
+}
+
+func unmarshalTime(data []byte, layout string) (time.Time, error) {
+	if string(data) == "null" {
+		return time.Time{}, nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return time.Time{}, errors.New("time values must be JSON strings")
+	}
+	return parseTime(text, layout)
+}
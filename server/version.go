@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"reflect"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// Rows carry a version in the _version field of their JSON form so that a
+// write can detect changes made since the client read the row. The version is
+// the value of the table's rowversion column where it has one, and otherwise
+// an HMAC of all column values keyed with VERSION_SECRET, so that callers
+// cannot test guesses of columns hidden from them against it.
+
+// versionField is the name of the generated struct field holding the version.
+const versionField = "RowVersion"
+
+// versionKey keys the row hashes.
+var versionKey []byte
+
+// loadVersionKey reads VERSION_SECRET. Without it a random key is used, so
+// versions change when the server restarts and differ between instances.
+func loadVersionKey() ([]byte, error) {
+	if secret := viper.GetString("VERSION_SECRET"); secret != "" {
+		return []byte(secret), nil
+	}
+
+	log.Println("VERSION_SECRET is not set, row versions are reset on restart")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// conflictError reports a write against a row that changed since it was
+// read. current is the row as it is now stored.
+type conflictError struct {
+	current interface{}
+}
+
+func (conflictError) Error() string {
+	return "Row was changed by another user"
+}
+
+// rowVersion computes the version of a row read with all columns.
+func rowVersion(columns []SchemaColumn, row interface{}) string {
+	values := convertGormStructToMap(row)
+
+	for _, col := range columns {
+		if col.RowVersion {
+			if version, ok := values[col.DbName].([]byte); ok {
+				return base64.StdEncoding.EncodeToString(version)
+			}
+		}
+	}
+
+	hash := hmac.New(sha256.New, versionKey)
+	for _, col := range columns {
+		encoded, _ := json.Marshal(values[col.DbName])
+		hash.Write(encoded)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// stampVersion sets the version of a row, given as a pointer to its struct.
+func stampVersion(table TableRef, row interface{}) error {
+	columns, err := getSchemaColumns(table)
+	if err != nil {
+		return err
+	}
+	reflect.ValueOf(row).Elem().FieldByName(versionField).SetString(rowVersion(columns, row))
+	return nil
+}
+
+// stampVersions sets the version of every row in a slice.
+func stampVersions(table TableRef, rows reflect.Value) error {
+	for i := 0; i < rows.Len(); i++ {
+		if err := stampVersion(table, rows.Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestedVersion returns the version a client sent with a row.
+func requestedVersion(row interface{}) string {
+	return reflect.ValueOf(row).Elem().FieldByName(versionField).String()
+}
+
+// checkVersion locks the row identified by where for the rest of the
+// transaction, verifies that it still has the version the client read and
+// returns it. A conflict reports the row as restrictions allow to read it.
+func checkVersion(tx *gorm.DB, table TableRef, where map[string]interface{}, version string, restrictions columnRestrictions) (interface{}, error) {
+	if version == "" {
+		return nil, statusError{428, "Missing _version. Read the row again before changing it"}
+	}
+
+	columns, err := getSchemaColumns(table)
+	if err != nil {
+		return nil, err
+	}
+
+	current := reflect.New(getStructSchema(table)).Interface()
+	rowsAffected, err := lockRow(tx, table, where, columnNames(columns), current)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, statusError{404, "Row not found"}
+	}
+
+	if rowVersion(columns, current) != version {
+		if err := stampVersion(table, current); err != nil {
+			return nil, err
+		}
+		return nil, conflictError{restrictions.row(current)}
+	}
+	return current, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+const accountsSchema = `
+CREATE TABLE accounts (id INTEGER PRIMARY KEY, owner TEXT NOT NULL, balance INTEGER NOT NULL);
+INSERT INTO accounts VALUES (1, 'ada', 100)`
+
+func TestVersionConflicts(t *testing.T) {
+	openTestDB(t, accountsSchema)
+
+	read := readRow(t, "accounts", "")
+	version, _ := read["_version"].(string)
+	if version == "" {
+		t.Fatalf("row has no _version: %v", read)
+	}
+
+	update := func(balance int, version interface{}) (int, map[string]interface{}) {
+		body := map[string]interface{}{"id": 1, "owner": "ada", "balance": balance}
+		if version != nil {
+			body["_version"] = version
+		}
+		w := serve(t, http.MethodPut, "/api/tables/accounts/data", jsonBody(t, body), "")
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	tests := []struct {
+		name    string
+		balance int
+		version interface{}
+		status  int
+	}{
+		{"missing version", 200, nil, 428},
+		{"current version", 200, version, 200},
+		{"stale version", 300, version, 409},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, response := update(test.balance, test.version)
+			if status != test.status {
+				t.Fatalf("got %d, want %d: %v", status, test.status, response)
+			}
+
+			if status == 409 {
+				current, _ := response["current"].(map[string]interface{})
+				if current["balance"] != 200.0 || current["_version"] == version {
+					t.Errorf("conflict does not report the current row: %v", response)
+				}
+			}
+		})
+	}
+
+	var balance int64
+	db.Table("accounts").Select("balance").Row().Scan(&balance)
+	if balance != 200 {
+		t.Errorf("got balance %d, want 200", balance)
+	}
+
+	body := jsonBody(t, map[string]interface{}{"id": 1, "_version": version})
+	if w := serve(t, http.MethodDelete, "/api/tables/accounts/data", body, ""); w.Code != 409 {
+		t.Errorf("delete with stale version returned %d, want 409", w.Code)
+	}
+	body = jsonBody(t, map[string]interface{}{"id": 1, "_version": readRow(t, "accounts", "")["_version"]})
+	if w := serve(t, http.MethodDelete, "/api/tables/accounts/data", body, ""); w.Code != 200 {
+		t.Errorf("delete with current version returned %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestVersionIsKeyed(t *testing.T) {
+	openTestDB(t, accountsSchema)
+
+	version := readRow(t, "accounts", "")["_version"]
+	versionKey = []byte("another secret")
+	if readRow(t, "accounts", "")["_version"] == version {
+		t.Error("row version does not depend on VERSION_SECRET")
+	}
+}
@@ -0,0 +1,31 @@
+import config from "./config";
+
+export type User = {
+    sub: string;
+    name?: string;
+    email?: string;
+    roles: string[];
+};
+
+// Sends the browser through the login flow whenever the API reports that the
+// session is missing or expired.
+export const installAuthRedirect = () => {
+    const originalFetch = window.fetch.bind(window);
+
+    window.fetch = async (input, init) => {
+        const response = await originalFetch(input, init);
+        const url = typeof input === 'string' ? input : input instanceof URL ? input.href : input.url;
+        if (response.status === 401 && url.includes(config.API_URL)) {
+            const redirect = window.location.pathname + window.location.search;
+            window.location.href = `/auth/login?redirect=${encodeURIComponent(redirect)}`;
+        }
+        return response;
+    };
+};
+
+export const fetchCurrentUser = async (): Promise<User | null> => {
+    const response = await fetch(`${config.API_URL}/me`);
+    if (!response.ok) return null;
+    const result = await response.json();
+    return result.authenticated ? result.user : null;
+};
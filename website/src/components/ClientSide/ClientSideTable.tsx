@@ -98,7 +98,7 @@ export const ClientSideTable: React.FC<TableProps> = ({table}) => {
                 }
                 return response.json();
             })
-            .then(() => {
+            .then((result) => {
                 enqueueSnackbar("New row saved successfully", {variant: 'success'});
                 setRowData(prev => {
                     const idx = prev.findIndex(row =>
@@ -108,7 +108,7 @@ export const ClientSideTable: React.FC<TableProps> = ({table}) => {
                     if (idx === -1) return prev;
 
                     const updated = [...prev];
-                    updated[idx] = {...updated[idx], __isNew: false};
+                    updated[idx] = {...updated[idx], ...result.data, __isNew: false};
                     return updated;
                 });
             })
@@ -58,6 +58,10 @@ export const InfiniteTable: React.FC<TableProps> = ({table}) => {
 
     const [rowToDelete, setRowToDelete] = useState<any>(null);
 
+    // Continuation tokens by filter, sort and start row, so that scrolling
+    // seeks by key instead of skipping ever more rows.
+    const cursors = useRef<Map<string, string>>(new Map());
+
 
     const loadColumns = (table: string) => {
         LoadColumnDefinitions(table, saveNewRow, setRowToDelete)
@@ -139,23 +143,37 @@ export const InfiniteTable: React.FC<TableProps> = ({table}) => {
             ...filter
         }));
 
+        const sort = params.sortModel.map(({colId, sort}) => ({
+            field: colId,
+            direction: sort
+        }));
+
         type Result = {
             data : any[];
             count: number;
+            nextCursor?: string;
         }
 
-        if (Object.keys(filterModel).length > 0) {
+        const cursorKey = (row: number) => JSON.stringify({table, filters, sort, row});
+        const cursor = startRow === 0 ? "" : cursors.current.get(cursorKey(startRow));
+
+        if (Object.keys(filterModel).length > 0 || sort.length > 0) {
             fetch(`${config.API_URL}/tables/${table}/query`, {
                 method: 'POST',
                 headers: {'Content-Type': 'application/json'},
                 body: JSON.stringify({
                     limit,
                     offset: startRow,
-                    filters
+                    filters,
+                    sort,
+                    cursor
                 })
             })
                 .then(response => response.json())
                 .then((data: Result) => {
+                    if (data.nextCursor) {
+                        cursors.current.set(cursorKey(startRow + data.data.length), data.nextCursor);
+                    }
                     const combined = [...newRows, ...data.data];
                     const lastRow = startRow + data.data.length >= data.count ? data.count : undefined;
                     params.successCallback(combined, lastRow);
@@ -166,8 +184,15 @@ export const InfiniteTable: React.FC<TableProps> = ({table}) => {
 
 
         } else {
-            fetch(`${config.API_URL}/tables/${table}/data?offset=${startRow}&limit=${limit}`,)
-                .then(response => response.json())
+            const cursorParam = cursor === undefined ? "" : `&cursor=${encodeURIComponent(cursor)}`;
+            fetch(`${config.API_URL}/tables/${table}/data?offset=${startRow}&limit=${limit}${cursorParam}`,)
+                .then(response => {
+                    const nextCursor = response.headers.get('X-Next-Cursor');
+                    if (nextCursor) {
+                        cursors.current.set(cursorKey(endRow), nextCursor);
+                    }
+                    return response.json();
+                })
                 .then((data: any[]) => {
                     const combined = [...newRows, ...data];
                     params.successCallback(combined, data.length < limit ? startRow + data.length : undefined);
@@ -203,6 +228,7 @@ export const InfiniteTable: React.FC<TableProps> = ({table}) => {
 
     const refresh = () => {
         console.log("Refreshing grid");
+        cursors.current.clear();
         gridRef.current?.api.refreshInfiniteCache();
     }
 
@@ -211,6 +237,43 @@ export const InfiniteTable: React.FC<TableProps> = ({table}) => {
         console.log(newRows.length)
     }
 
+    const exportRows = () => {
+        if (!table) return;
+
+        const filterModel = gridRef.current?.api.getFilterModel() || {};
+        const filters = Object.entries(filterModel).map(([field, filter]) => ({
+            field,
+            ...filter
+        }));
+        const sort = (gridRef.current?.api.getColumnState() || [])
+            .filter(column => column.sort)
+            .sort((a, b) => (a.sortIndex ?? 0) - (b.sortIndex ?? 0))
+            .map(column => ({field: column.colId, direction: column.sort}));
+
+        fetch(`${config.API_URL}/tables/${table}/export`, {
+            method: 'POST',
+            headers: {'Content-Type': 'application/json'},
+            body: JSON.stringify({format: 'xlsx', filters, sort})
+        })
+            .then(response => {
+                if (!response.ok) {
+                    throw new Error(`HTTP error! Status: ${response.status}`);
+                }
+                return response.blob();
+            })
+            .then(blob => {
+                const url = URL.createObjectURL(blob);
+                const link = document.createElement('a');
+                link.href = url;
+                link.download = `${table}.xlsx`;
+                link.click();
+                URL.revokeObjectURL(url);
+            })
+            .catch((error) => {
+                enqueueSnackbar("Error exporting rows: " + error.message, {variant: 'error'});
+            });
+    }
+
     const resetNewRows = () => {
         setNewRows([]);
     }
@@ -245,6 +308,11 @@ export const InfiniteTable: React.FC<TableProps> = ({table}) => {
                                 Debug
                             </Button>
                         </Grid>
+                        <Grid size={1}>
+                            <Button sx={{width: '100%'}} variant="outlined" disabled={!table} onClick={exportRows}>
+                                Export
+                            </Button>
+                        </Grid>
                         <Grid size="grow"/>
 
                         <Grid size={0.5}>
@@ -18,13 +18,25 @@ type TableColumn = {
     type: string;
     key: boolean;
     filterable: boolean;
-    foreignKeyName: string
+    foreignKeyName: string;
+    nullable: boolean;
+    maxLength: number | null;
+    identity: boolean;
+    computed: boolean;
+    readOnly: boolean;
+    masked: boolean;
 };
 
 type TableSchema = {
     columns: TableColumn[];
 };
 
+// The API sends dates as ISO strings, so use AG Grid's string based date types.
+const cellDataTypes: { [key: string]: string } = {
+    date: 'dateString',
+    datetime: 'dateTimeString',
+};
+
 const retrieveForeignKeyOptions = async (foreignKeyName: string) => {
     try {
         const response = await fetch(`${config.API_URL}/foreign-keys/${foreignKeyName}/data`);
@@ -61,8 +73,8 @@ export const LoadColumnDefinitions = async (
                 sortable: true,
                 filter: !col.foreignKeyName,
                 resizable: true,
-                cellDataType: col.type,
-                editable: (params: any) => params.data.__isNew === true || !col.key,
+                cellDataType: cellDataTypes[col.type] || col.type,
+                editable: (params: any) => !col.computed && !col.identity && !col.readOnly && (params.data.__isNew === true || !col.key),
                 headerComponentParams: {
                     innerHeaderComponent: () => (
                         <Box sx={{display: 'flex', alignItems: 'center'}}>
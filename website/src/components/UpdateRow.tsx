@@ -10,13 +10,20 @@ export const updateRow = (table:string, params: any) => {
         headers: {'Content-Type': 'application/json'},
         body: JSON.stringify(params.data)
     })
-        .then(response => {
+        .then(async response => {
+            if (response.status === 409) {
+                // Someone else changed the row; show what is stored now.
+                const conflict = await response.json();
+                params.node.setData(conflict.current);
+                throw new Error("The row was changed by another user and has been reloaded");
+            }
             if (!response.ok) {
                 throw new Error(`HTTP error! Status: ${response.status}`);
             }
             return response.json();
         })
-        .then(() => {
+        .then((result) => {
+            params.node.setData({...params.data, ...result.data});
             enqueueSnackbar("Data updated successfully", {variant: 'success'});
         })
         .catch(
@@ -2,6 +2,9 @@ import React from "react";
 import ReactDOM from "react-dom/client";
 import App from "./App";
 import { SnackbarProvider } from 'notistack';
+import {installAuthRedirect} from "./auth";
+
+installAuthRedirect();
 
 
 const root = ReactDOM.createRoot(document.getElementById("root")!);
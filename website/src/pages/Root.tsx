@@ -3,14 +3,22 @@ import Box from '@mui/material/Box';
 
 import Grid from '@mui/material/Grid';
 import './Root.css';
-import {FormControl, InputLabel, MenuItem, Select, SelectChangeEvent, Stack} from "@mui/material";
+import {Button, FormControl, InputLabel, MenuItem, Select, SelectChangeEvent, Stack, Typography} from "@mui/material";
 import {InfiniteTable} from "../components/InfiniteTable/InfiniteTable";
 import { useNavigate, useParams } from "react-router-dom";
 import config from '../config';
 import {enqueueSnackbar} from "notistack";
 import {ClientSideTable} from "../components/ClientSide/ClientSideTable";
+import {fetchCurrentUser, User} from "../auth";
 
 
+type TableInfo = {
+    schema: string;
+    name: string;
+    type: string;
+    updatable: boolean;
+};
+
 const Root: React.FC = () => {
     const navigate = useNavigate();
     const { table } = useParams<{ table: string }>();
@@ -19,6 +27,7 @@ const Root: React.FC = () => {
     const [selectedTable, setSelectedTable] = useState<string | undefined>(table);
 
     const [tableCount, setTableCount] = useState<number | null>(null);
+    const [user, setUser] = useState<User | null>(null);
 
     const getTableCount = () => {
         fetch(`${config.API_URL}/tables/${table}/count`, {
@@ -40,10 +49,14 @@ const Root: React.FC = () => {
             });
     }
 
+    useEffect(() => {
+        fetchCurrentUser().then(setUser).catch(() => setUser(null));
+    }, []);
+
     useEffect(() => {
         fetch(`${config.API_URL}/tables`)
             .then(response => response.json())
-            .then(data => setTables(data))
+            .then((data: TableInfo[]) => setTables(data.map(t => `${t.schema}.${t.name}`)))
             .catch(() => setTables([]));
     }, []);
 
@@ -78,7 +91,14 @@ const Root: React.FC = () => {
                     </Select>
                 </FormControl>
             </Grid>
-            <Grid size={10}/>
+            <Grid size={10}>
+                {user && (
+                    <Stack direction="row" spacing={2} justifyContent="flex-end" alignItems="center">
+                        <Typography variant="body2">{user.name || user.email || user.sub}</Typography>
+                        <Button size="small" href="/auth/logout">Sign out</Button>
+                    </Stack>
+                )}
+            </Grid>
 
             <Grid size={12} justifyContent={"center"}>
                 <Box sx={{width: '98%', height: '88vh'}}>